@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var scrapesCoalesced = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "redfish",
+		Subsystem: "exporter",
+		Name:      "scrapes_coalesced_total",
+		Help:      "Scrapes answered with the result of another scrape of the same target, group and module, by reason (in_flight, cached).",
+	},
+	[]string{"reason"},
+)
+
+func init() {
+	prometheus.MustRegister(scrapesCoalesced)
+}
+
+// scrapeCoalescer lets concurrent scrapes of the same target, group and module share one walk of the BMC, and
+// answers scrapes with the previous result as long as it is not older than maxAge.
+type scrapeCoalescer struct {
+	mu     sync.Mutex
+	calls  map[PollTarget]*scrapeCall
+	maxAge time.Duration
+}
+
+// scrapeCall is a scrape shared by all callers asking for the same key, result is set once done is closed. waiters
+// counts the callers waiting for the result, the scrape is cancelled when the last of them goes away.
+type scrapeCall struct {
+	done    chan struct{}
+	result  *pollResult
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func newScrapeCoalescer(maxAge time.Duration) *scrapeCoalescer {
+	return &scrapeCoalescer{
+		calls:  make(map[PollTarget]*scrapeCall),
+		maxAge: maxAge,
+	}
+}
+
+// Do returns the result of the scrape running or recently completed for key, and runs scrape otherwise. The context
+// passed to scrape is done once ctx and the contexts of all callers that joined the scrape are done. Do returns nil
+// when ctx is done before the shared scrape completes, and whether the result was shared.
+func (c *scrapeCoalescer) Do(ctx context.Context, key PollTarget, scrape func(context.Context) *pollResult) (*pollResult, bool) {
+	c.mu.Lock()
+	if call, ok := c.calls[key]; ok {
+		select {
+		case <-call.done:
+			if call.result != nil && time.Since(call.result.time) <= c.maxAge {
+				c.mu.Unlock()
+				scrapesCoalesced.WithLabelValues("cached").Inc()
+				return call.result, true
+			}
+		default:
+			call.waiters++
+			c.mu.Unlock()
+			scrapesCoalesced.WithLabelValues("in_flight").Inc()
+			return c.wait(ctx, key, call), true
+		}
+	}
+	c.prune()
+	scrapeCtx, cancel := context.WithCancel(context.Background())
+	call := &scrapeCall{done: make(chan struct{}), waiters: 1, cancel: cancel}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	go func() {
+		result := scrape(scrapeCtx)
+		// the result of a scrape nobody waits for anymore is incomplete, it must not be served from the cache
+		if scrapeCtx.Err() == nil {
+			call.result = result
+		}
+		cancel()
+		close(call.done)
+
+		if c.maxAge <= 0 {
+			c.mu.Lock()
+			if c.calls[key] == call {
+				delete(c.calls, key)
+			}
+			c.mu.Unlock()
+		}
+	}()
+	return c.wait(ctx, key, call), false
+}
+
+// wait returns the result of the call once it is done, or nil when ctx is done first. The call is cancelled and
+// forgotten when the last caller waiting for it leaves.
+func (c *scrapeCoalescer) wait(ctx context.Context, key PollTarget, call *scrapeCall) *pollResult {
+	select {
+	case <-call.done:
+		return call.result
+	case <-ctx.Done():
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	call.waiters--
+	if call.waiters == 0 {
+		call.cancel()
+		if c.calls[key] == call {
+			delete(c.calls, key)
+		}
+	}
+	return nil
+}
+
+// prune forgets completed scrapes older than maxAge, the caller must hold c.mu.
+func (c *scrapeCoalescer) prune() {
+	for key, call := range c.calls {
+		select {
+		case <-call.done:
+			if call.result == nil || time.Since(call.result.time) > c.maxAge {
+				delete(c.calls, key)
+			}
+		default:
+		}
+	}
+}
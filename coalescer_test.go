@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestScrapeCoalescerShares(t *testing.T) {
+	coalescer := newScrapeCoalescer(0)
+	key := PollTarget{Target: "bmc"}
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	want := &pollResult{time: time.Now()}
+
+	results := make(chan *pollResult)
+	go func() {
+		result, _ := coalescer.Do(context.Background(), key, func(ctx context.Context) *pollResult {
+			close(started)
+			<-finish
+			return want
+		})
+		results <- result
+	}()
+	<-started
+	go func() {
+		result, shared := coalescer.Do(context.Background(), key, func(ctx context.Context) *pollResult {
+			t.Error("scrape started while another one is running")
+			return nil
+		})
+		if !shared {
+			t.Error("Do() did not share the running scrape")
+		}
+		results <- result
+	}()
+	// let the second caller join before the scrape completes
+	time.Sleep(50 * time.Millisecond)
+	close(finish)
+	for i := 0; i < 2; i++ {
+		if result := <-results; result != want {
+			t.Errorf("Do() = %v, want the result of the shared scrape", result)
+		}
+	}
+}
+
+func TestScrapeCoalescerCancelsAbandonedScrape(t *testing.T) {
+	coalescer := newScrapeCoalescer(time.Minute)
+	key := PollTarget{Target: "bmc"}
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	scrape := func(ctx context.Context) *pollResult {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return &pollResult{err: ctx.Err(), time: time.Now()}
+	}
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+	results := make(chan *pollResult)
+	go func() {
+		result, _ := coalescer.Do(first, key, scrape)
+		results <- result
+	}()
+	<-started
+	go func() {
+		result, _ := coalescer.Do(second, key, scrape)
+		results <- result
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	cancelFirst()
+	if result := <-results; result != nil {
+		t.Errorf("Do() of a caller that went away = %v, want nil", result)
+	}
+	select {
+	case <-cancelled:
+		t.Fatal("scrape cancelled while a caller still waits for it")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancelSecond()
+	<-results
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("scrape not cancelled after all callers went away")
+	}
+
+	// the abandoned scrape is not served from the cache
+	fresh := &pollResult{time: time.Now()}
+	result, shared := coalescer.Do(context.Background(), key, func(ctx context.Context) *pollResult { return fresh })
+	if result != fresh || shared {
+		t.Errorf("Do() after an abandoned scrape = %v, %t, want a new scrape", result, shared)
+	}
+}
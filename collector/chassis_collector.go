@@ -1,10 +1,10 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"strings"
-	"sync"
 
 	"github.com/apex/log"
 	"github.com/prometheus/client_golang/prometheus"
@@ -20,21 +20,30 @@ var (
 	ChassisTemperatureLabelNames      = []string{"resource", "chassis_id", "sensor", "sensor_id"}
 	ChassisFanLabelNames              = []string{"resource", "chassis_id", "fan", "fan_id", "fan_unit"}
 	ChassisPowerVoltageLabelNames     = []string{"resource", "chassis_id", "power_voltage", "power_voltage_id"}
+	ChassisPowerControlLabelNames     = []string{"resource", "chassis_id", "power_control", "power_control_id"}
 	ChassisPowerSupplyLabelNames      = []string{"resource", "chassis_id", "power_supply", "power_supply_id"}
+	ChassisEnergyLabelNames           = []string{"resource", "chassis_id"}
 	ChassisNetworkAdapterLabelNames   = []string{"resource", "chassis_id", "network_adapter", "network_adapter_id"}
 	ChassisNetworkPortLabelNames      = []string{"resource", "chassis_id", "network_adapter", "network_adapter_id", "network_port", "network_port_id", "network_port_type", "network_port_speed", "network_port_connectiont_type", "network_physical_port_number"}
 	ChassisPhysicalSecurityLabelNames = []string{"resource", "chassis_id", "intrusion_sensor_number", "intrusion_sensor_rearm"}
 
-	ChassisLogServiceLabelNames = []string{"chassis_id", "log_service", "log_service_id", "log_service_enabled", "log_service_overwrite_policy"}
-	ChassisLogEntryLabelNames   = []string{"chassis_id", "log_service", "log_service_id", "log_entry", "log_entry_id", "log_entry_code", "log_entry_type", "log_entry_message_id", "log_entry_sensor_number", "log_entry_sensor_type"}
+	ChassisLogServiceLabelNames    = []string{"chassis_id", "log_service", "log_service_id", "log_service_enabled", "log_service_overwrite_policy"}
+	ChassisLogEntryCountLabelNames = []string{"chassis_id", "log_service", "log_service_id", "severity"}
+	ChassisLogEntryTotalLabelNames = []string{"chassis_id", "log_service", "log_service_id", "severity", "message_id"}
+	ChassisLogEntryLabelNames      = []string{"chassis_id", "log_service", "log_service_id", "log_entry", "log_entry_id", "log_entry_code", "log_entry_type", "log_entry_message_id", "log_entry_sensor_number", "log_entry_sensor_type", "log_entry_message"}
 
 	chassisMetrics = createChassisMetricMap()
 )
 
 // ChassisCollector implements the prometheus.Collector.
 type ChassisCollector struct {
+	ctx                   context.Context
 	redfishClient         *gofish.APIClient
+	pool                  *WorkerPool
+	logs                  *TargetLogs
 	metrics               map[string]Metric
+	options               *ScrapeOptions
+	scrapeErrors          *ScrapeErrors
 	collectorScrapeStatus *prometheus.GaugeVec
 	Log                   *log.Entry
 }
@@ -48,6 +57,7 @@ func createChassisMetricMap() map[string]Metric {
 	addToMetricMap(chassisMetrics, ChassisSubsystem, "temperature_sensor_state", fmt.Sprintf("status state of temperature on this chassis component,%s", CommonStateHelp), ChassisTemperatureLabelNames)
 	addToMetricMap(chassisMetrics, ChassisSubsystem, "temperature_sensor_health", fmt.Sprintf("status health of temperature on this chassis component,%s", CommonStateHelp), ChassisTemperatureLabelNames)
 	addToMetricMap(chassisMetrics, ChassisSubsystem, "temperature_celsius", "celsius of temperature on this chassis component", ChassisTemperatureLabelNames)
+	addThresholdsToMetricMap(chassisMetrics, ChassisSubsystem, "temperature", "celsius", "temperature on this chassis component", ChassisTemperatureLabelNames)
 
 	addToMetricMap(chassisMetrics, ChassisSubsystem, "fan_health", fmt.Sprintf("fan health on this chassis component,%s", CommonHealthHelp), ChassisFanLabelNames)
 	addToMetricMap(chassisMetrics, ChassisSubsystem, "fan_state", fmt.Sprintf("fan state on this chassis component,%s", CommonStateHelp), ChassisFanLabelNames)
@@ -64,7 +74,19 @@ func createChassisMetricMap() map[string]Metric {
 
 	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_voltage_state", fmt.Sprintf("power voltage state of chassis component,%s", CommonStateHelp), ChassisPowerVoltageLabelNames)
 	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_voltage_volts", "power voltage volts number of chassis component", ChassisPowerVoltageLabelNames)
-	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_average_consumed_watts", "power wattage watts number of chassis component", ChassisPowerVoltageLabelNames)
+	addThresholdsToMetricMap(chassisMetrics, ChassisSubsystem, "power_voltage", "volts", "power voltage of chassis component", ChassisPowerVoltageLabelNames)
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_average_consumed_watts", "power wattage watts number of chassis component", ChassisPowerControlLabelNames)
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_control_consumed_watts", "actual power consumed by the chassis component of the power control, in watts", ChassisPowerControlLabelNames)
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_control_capacity_watts", "total power capacity available for allocation to the chassis component of the power control, in watts", ChassisPowerControlLabelNames)
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_control_allocated_watts", "total power allocated to the chassis component of the power control, in watts", ChassisPowerControlLabelNames)
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_control_requested_watts", "power requested by the chassis component of the power control, in watts", ChassisPowerControlLabelNames)
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_control_available_watts", "power available but not allocated to the chassis component of the power control, in watts", ChassisPowerControlLabelNames)
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_control_limit_watts", "power limit of the power control, in watts, only set when a limit is enforced", ChassisPowerControlLabelNames)
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_control_limit_correction_seconds", "time allowed to bring the power consumption back under the power limit before the limit exception applies, in seconds", ChassisPowerControlLabelNames)
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_control_limit_exception", fmt.Sprintf("action taken when the power limit is exceeded and not corrected in time,%s", CommonLimitExceptionHelp), ChassisPowerControlLabelNames)
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_control_min_consumed_watts", "lowest power consumption of the chassis component of the power control over the interval, in watts", ChassisPowerControlLabelNames)
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_control_max_consumed_watts", "highest power consumption of the chassis component of the power control over the interval, in watts", ChassisPowerControlLabelNames)
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_control_interval_seconds", "interval over which the minimum, maximum and average power consumption are measured, in seconds", ChassisPowerControlLabelNames)
 
 	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_powersupply_state", fmt.Sprintf("powersupply state of chassis component,%s", CommonStateHelp), ChassisPowerSupplyLabelNames)
 	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_powersupply_health", fmt.Sprintf("powersupply health of chassis component,%s", CommonHealthHelp), ChassisPowerSupplyLabelNames)
@@ -73,6 +95,12 @@ func createChassisMetricMap() map[string]Metric {
 	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_powersupply_power_input_watts", "measured input power, in Watts, of powersupply on this chassis", ChassisPowerSupplyLabelNames)
 	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_powersupply_power_output_watts", "measured output power, in Watts, of powersupply on this chassis", ChassisPowerSupplyLabelNames)
 	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_powersupply_power_capacity_watts", "power_capacity_watts of powersupply on this chassis", ChassisPowerSupplyLabelNames)
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "power_powersupply_energy_joules_total", "energy consumed by the powersupply on this chassis since its counter was reset, in joules", ChassisPowerSupplyLabelNames)
+
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "energy_consumed_joules_total", "energy consumed by the chassis since its counter was reset, in joules, from the EnergykWh of its EnvironmentMetrics", ChassisEnergyLabelNames)
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "energy_estimated_joules_total", "energy consumed by the chassis since the exporter started polling it, in joules, estimated from its power consumption when it has no energy counter", ChassisEnergyLabelNames)
+
+	addSensorsToMetricMap(chassisMetrics)
 
 	addToMetricMap(chassisMetrics, ChassisSubsystem, "network_adapter_state", fmt.Sprintf("chassis network adapter state,%s", CommonStateHelp), ChassisNetworkAdapterLabelNames)
 	addToMetricMap(chassisMetrics, ChassisSubsystem, "network_adapter_health_state", fmt.Sprintf("chassis network adapter health state,%s", CommonHealthHelp), ChassisNetworkAdapterLabelNames)
@@ -84,18 +112,24 @@ func createChassisMetricMap() map[string]Metric {
 
 	addToMetricMap(chassisMetrics, ChassisSubsystem, "log_service_state", fmt.Sprintf("chassis log service state,%s", CommonStateHelp), ChassisLogServiceLabelNames)
 	addToMetricMap(chassisMetrics, ChassisSubsystem, "log_service_health_state", fmt.Sprintf("chassis log service health state,%s", CommonHealthHelp), ChassisLogServiceLabelNames)
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "log_entries", "chassis log entries by log service and severity", ChassisLogEntryCountLabelNames)
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "log_entry_newest_timestamp_seconds", "chassis creation time of the newest log entry by log service and severity, in seconds since the epoch", ChassisLogEntryCountLabelNames)
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "log_entries_total", "chassis log entries seen by log service, severity and message ID when log entries are fetched incrementally", ChassisLogEntryTotalLabelNames)
 	addToMetricMap(chassisMetrics, ChassisSubsystem, "log_entry_severity_state", fmt.Sprintf("chassis log entry severity state,%s", CommonSeverityHelp), ChassisLogEntryLabelNames)
 
 	return chassisMetrics
 }
 
 // NewChassisCollector returns a collector that collecting chassis statistics
-func NewChassisCollector(redfishClient *gofish.APIClient, logger *log.Entry) *ChassisCollector {
-	// get service from redfish client
-
+func NewChassisCollector(ctx context.Context, redfishClient *gofish.APIClient, pool *WorkerPool, logs *TargetLogs, options *ScrapeOptions, scrapeErrors *ScrapeErrors, logger *log.Entry) *ChassisCollector {
 	return &ChassisCollector{
+		ctx:           ctx,
 		redfishClient: redfishClient,
+		pool:          pool,
+		logs:          logs,
 		metrics:       chassisMetrics,
+		options:       options,
+		scrapeErrors:  scrapeErrors,
 		Log: logger.WithFields(log.Fields{
 			"collector": "ChassisCollector",
 		}),
@@ -103,7 +137,7 @@ func NewChassisCollector(redfishClient *gofish.APIClient, logger *log.Entry) *Ch
 			prometheus.GaugeOpts{
 				Namespace: namespace,
 				Name:      "collector_scrape_status",
-				Help:      "collector_scrape_status",
+				Help:      "collector scrape status,1(Success),0(Failure) if the collector could not list its resources",
 			},
 			[]string{"collector"},
 		),
@@ -123,13 +157,22 @@ func (c *ChassisCollector) Describe(ch chan<- *prometheus.Desc) {
 func (c *ChassisCollector) Collect(ch chan<- prometheus.Metric) {
 	collectorLogContext := c.Log
 	service := c.redfishClient.Service
+	tasks := c.pool.NewTaskGroup(c.ctx)
 
 	// get a list of chassis from service
+	listed := false
 	if chassises, err := service.Chassis(); err != nil {
 		collectorLogContext.WithField("operation", "service.Chassis()").WithError(err).Error("error getting chassis from service")
+		c.scrapeErrors.add("chassis", "service.Chassis()")
 	} else {
+		listed = true
 		// process the chassises
 		for _, chassis := range chassises {
+			if c.ctx.Err() != nil {
+				collectorLogContext.WithError(c.ctx.Err()).Warn("scrape deadline reached, skipping remaining chassises")
+				break
+			}
+			chassis := chassis
 			chassisLogContext := collectorLogContext.WithField("Chassis", chassis.ID)
 			chassisLogContext.Info("collector scrape started")
 			chassisID := chassis.ID
@@ -151,123 +194,172 @@ func (c *ChassisCollector) Collect(ch chan<- prometheus.Metric) {
 			ChassisModelLabelValues := []string{"chassis", chassisID, chassisManufacturer, chassisModel, chassisPartNumber, chassisSKU}
 			ch <- prometheus.MustNewConstMetric(c.metrics["chassis_model_info"].desc, prometheus.GaugeValue, 1, ChassisModelLabelValues...)
 
-			chassisThermal, err := chassis.Thermal()
-			if err != nil {
-				chassisLogContext.WithField("operation", "chassis.Thermal()").WithError(err).Error("error getting thermal data from chassis")
-			} else if chassisThermal == nil {
-				chassisLogContext.WithField("operation", "chassis.Thermal()").Info("no thermal data found")
-			} else {
-				// process temperature
-				chassisTemperatures := chassisThermal.Temperatures
-				wg := &sync.WaitGroup{}
-				wg.Add(len(chassisTemperatures))
-
-				for _, chassisTemperature := range chassisTemperatures {
-					go parseChassisTemperature(ch, chassisID, chassisTemperature, wg)
-				}
+			resources := newChassisResources(c.redfishClient, chassis)
+			if c.options.resourceEnabled("chassis", "thermal") {
+				tasks.Go(func() {
+					// the ThermalSubsystem is preferred, Thermal is deprecated
+					if c.collectThermalSubsystem(ch, chassisID, resources) {
+						return
+					}
+					chassisThermal, chassisTemperatureSensors, err := resources.thermal()
+					if err != nil {
+						chassisLogContext.WithField("operation", "chassis.Thermal()").WithError(err).Error("error getting thermal data from chassis")
+						c.scrapeErrors.add("chassis", "chassis.Thermal()")
+					} else if chassisThermal == nil {
+						chassisLogContext.WithField("operation", "chassis.Thermal()").Info("no thermal data found")
+					} else {
+						// process temperature
+						for i, chassisTemperature := range chassisThermal.Temperatures {
+							parseChassisTemperature(ch, chassisID, chassisTemperature, legacySensorAt(chassisTemperatureSensors, i))
+						}
+
+						// process fans
+						for _, chassisFan := range chassisThermal.Fans {
+							parseChassisFan(ch, chassisID, chassisFan)
+						}
+					}
+				})
+			}
 
-				// process fans
+			if c.options.resourceEnabled("chassis", "power") {
+				tasks.Go(func() {
+					// the PowerSubsystem and EnvironmentMetrics are preferred, Power is deprecated but its PowerControl
+					// has no counterpart in the newer resources
+					chassisPowerInfo, chassisPowerReadings, err := resources.power()
+					if err != nil {
+						chassisLogContext.WithField("operation", "chassis.Power()").WithError(err).Error("error getting power data from chassis")
+						c.scrapeErrors.add("chassis", "chassis.Power()")
+					}
+					var chassisPowerControls []redfish.PowerControl
+					if chassisPowerInfo != nil {
+						chassisPowerControls = chassisPowerInfo.PowerControl
+					}
+					if c.collectPowerSubsystem(ch, chassisID, resources, chassisPowerControls, chassisPowerReadings.consumedWatts()) {
+						return
+					}
+					if chassisPowerInfo == nil {
+						if err == nil {
+							chassisLogContext.WithField("operation", "chassis.Power()").Info("no power data found")
+						}
+						return
+					}
+					// power voltages
+					for i, chassisPowerInfoVoltage := range chassisPowerInfo.Voltages {
+						parseChassisPowerInfoVoltage(ch, chassisID, chassisPowerInfoVoltage, legacySensorAt(chassisPowerReadings.Voltages, i))
+					}
 
-				chassisFans := chassisThermal.Fans
-				wg2 := &sync.WaitGroup{}
-				wg2.Add(len(chassisFans))
-				for _, chassisFan := range chassisFans {
-					go parseChassisFan(ch, chassisID, chassisFan, wg2)
-				}
-			}
+					// power control
+					for _, chassisPowerInfoPowerControl := range chassisPowerInfo.PowerControl {
+						parseChassisPowerInfoPowerControl(ch, chassisID, chassisPowerInfoPowerControl)
+					}
 
-			chassisPowerInfo, err := chassis.Power()
-			if err != nil {
-				chassisLogContext.WithField("operation", "chassis.Power()").WithError(err).Error("error getting power data from chassis")
-			} else if chassisPowerInfo == nil {
-				chassisLogContext.WithField("operation", "chassis.Power()").Info("no power data found")
-			} else {
-				// power voltages
-				chassisPowerInfoVoltages := chassisPowerInfo.Voltages
-				wg3 := &sync.WaitGroup{}
-				wg3.Add(len(chassisPowerInfoVoltages))
-				for _, chassisPowerInfoVoltage := range chassisPowerInfoVoltages {
-					go parseChassisPowerInfoVoltage(ch, chassisID, chassisPowerInfoVoltage, wg3)
-				}
+					// powerSupply
+					for _, chassisPowerInfoPowerSupply := range chassisPowerInfo.PowerSupplies {
+						parseChassisPowerInfoPowerSupply(ch, chassisID, chassisPowerInfoPowerSupply)
+					}
 
-				// power control
-				chassisPowerInfoPowerControls := chassisPowerInfo.PowerControl
-				wg4 := &sync.WaitGroup{}
-				wg4.Add(len(chassisPowerInfoPowerControls))
-				for _, chassisPowerInfoPowerControl := range chassisPowerInfoPowerControls {
-					go parseChassisPowerInfoPowerControl(ch, chassisID, chassisPowerInfoPowerControl, wg4)
-				}
+					// Power has no energy counter, the first power control is the consumption of the whole chassis
+					c.parseChassisEnergyEstimate(ch, chassisID, resources, false, chassisPowerReadings.consumedWatts())
+				})
+			}
 
-				// powerSupply
-				chassisPowerInfoPowerSupplies := chassisPowerInfo.PowerSupplies
-				wg5 := &sync.WaitGroup{}
-				wg5.Add(len(chassisPowerInfoPowerSupplies))
-				for _, chassisPowerInfoPowerSupply := range chassisPowerInfoPowerSupplies {
-					go parseChassisPowerInfoPowerSupply(ch, chassisID, chassisPowerInfoPowerSupply, wg5)
-				}
+			if c.options.resourceEnabled("chassis", "sensors") {
+				tasks.Go(func() {
+					sensors, err := resources.allSensors()
+					if err != nil {
+						chassisLogContext.WithField("operation", "chassis.Sensors()").WithError(err).Error("error getting sensors from chassis")
+						c.scrapeErrors.add("chassis", "chassis.Sensors()")
+					}
+					// the temperatures and voltages already exported by the thermal and power resources are left out
+					exported := resources.subsystemReadingTypes(c.options.resourceEnabled("chassis", "thermal"), c.options.resourceEnabled("chassis", "power"))
+					for _, sensor := range sensors {
+						if exported[sensor.ReadingType] {
+							continue
+						}
+						parseChassisSensor(ch, chassisID, sensor)
+					}
+				})
 			}
 
 			// process NetapAdapter
-
-			networkAdapters, err := chassis.NetworkAdapters()
-			if err != nil {
-				chassisLogContext.WithField("operation", "chassis.NetworkAdapters()").WithError(err).Error("error getting network adapters data from chassis")
-			} else if networkAdapters == nil {
-				chassisLogContext.WithField("operation", "chassis.NetworkAdapters()").Info("no network adapters data found")
-			} else {
-				wg5 := &sync.WaitGroup{}
-				wg5.Add(len(networkAdapters))
-
-				for _, networkAdapter := range networkAdapters {
-					if err = parseNetworkAdapter(ch, chassisID, networkAdapter, wg5); err != nil {
-						chassisLogContext.WithField("operation", "chassis.NetworkAdapters()").WithError(err).Error("error getting network ports from network adapter")
+			if c.options.resourceEnabled("chassis", "network_adapters") {
+				tasks.Go(func() {
+					networkAdapters, err := chassis.NetworkAdapters()
+					if err != nil {
+						chassisLogContext.WithField("operation", "chassis.NetworkAdapters()").WithError(err).Error("error getting network adapters data from chassis")
+						c.scrapeErrors.add("chassis", "chassis.NetworkAdapters()")
+					} else if networkAdapters == nil {
+						chassisLogContext.WithField("operation", "chassis.NetworkAdapters()").Info("no network adapters data found")
+					} else {
+						for _, networkAdapter := range networkAdapters {
+							networkAdapter := networkAdapter
+							tasks.Go(func() {
+								if err := parseNetworkAdapter(ch, chassisID, networkAdapter); err != nil {
+									chassisLogContext.WithField("operation", "chassis.NetworkAdapters()").WithError(err).Error("error getting network ports from network adapter")
+									c.scrapeErrors.add("chassis", "chassis.NetworkAdapters()")
+								}
+							})
+						}
 					}
-				}
+				})
 			}
 
-			physicalSecurity := chassis.PhysicalSecurity
-			if physicalSecurity != (redfish.PhysicalSecurity{}) {
-				physicalSecurityIntrusionSensor := physicalSecurity.IntrusionSensor
-				physicalSecurityIntrusionSensorNumber := fmt.Sprint(physicalSecurity.IntrusionSensorNumber)
-				physicalSecurityIntrusionSensorReArmMethod := string(physicalSecurity.IntrusionSensorReArm)
+			if c.options.resourceEnabled("chassis", "physical_security") {
+				physicalSecurity := chassis.PhysicalSecurity
+				if physicalSecurity != (redfish.PhysicalSecurity{}) {
+					physicalSecurityIntrusionSensor := physicalSecurity.IntrusionSensor
+					physicalSecurityIntrusionSensorNumber := fmt.Sprint(physicalSecurity.IntrusionSensorNumber)
+					physicalSecurityIntrusionSensorReArmMethod := string(physicalSecurity.IntrusionSensorReArm)
 
-				if phySecIntrusionSensor, ok := parsePhySecIntrusionSensor(physicalSecurityIntrusionSensor); ok {
-					ChassisPhysicalSecurityLabelValues := []string{"physical_security", chassisID, physicalSecurityIntrusionSensorNumber, physicalSecurityIntrusionSensorReArmMethod}
-					ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_physical_security_sensor_state"].desc, prometheus.GaugeValue, phySecIntrusionSensor, ChassisPhysicalSecurityLabelValues...)
+					if phySecIntrusionSensor, ok := parsePhySecIntrusionSensor(physicalSecurityIntrusionSensor); ok {
+						ChassisPhysicalSecurityLabelValues := []string{"physical_security", chassisID, physicalSecurityIntrusionSensorNumber, physicalSecurityIntrusionSensorReArmMethod}
+						ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_physical_security_sensor_state"].desc, prometheus.GaugeValue, phySecIntrusionSensor, ChassisPhysicalSecurityLabelValues...)
+					}
 				}
 			}
 
 			// process log services
-			logServices, err := chassis.LogServices()
-			if err != nil {
-				chassisLogContext.WithField("operation", "chassis.LogServices()").WithError(err).Error("error getting log services from chassis")
-			} else if logServices == nil {
-				chassisLogContext.WithField("operation", "chassis.LogServices()").Info("no log services found")
-			} else {
-				wg6 := &sync.WaitGroup{}
-				wg6.Add(len(logServices))
-
-				for _, logService := range logServices {
-					if err = parseLogService(ch, chassisMetrics, ChassisSubsystem, chassisID, logService, wg6); err != nil {
-						chassisLogContext.WithField("operation", "chassis.LogServices()").WithError(err).Error("error getting log entries from log service")
+			if c.options.resourceEnabled("chassis", "log_services") {
+				tasks.Go(func() {
+					logServices, err := chassis.LogServices()
+					if err != nil {
+						chassisLogContext.WithField("operation", "chassis.LogServices()").WithError(err).Error("error getting log services from chassis")
+						c.scrapeErrors.add("chassis", "chassis.LogServices()")
+					} else if logServices == nil {
+						chassisLogContext.WithField("operation", "chassis.LogServices()").Info("no log services found")
+					} else {
+						for _, logService := range logServices {
+							logService := logService
+							tasks.Go(func() {
+								if err := parseLogService(ch, chassisMetrics, ChassisSubsystem, chassisID, logService, c.options.logEntryOptions(), c.logs); err != nil {
+									chassisLogContext.WithField("operation", "chassis.LogServices()").WithError(err).Error("error getting log entries from log service")
+									c.scrapeErrors.add("chassis", "chassis.LogServices()")
+								}
+							})
+						}
 					}
-				}
+				})
 			}
-			chassisLogContext.Info("collector scrape completed")
 		}
 	}
 
-	c.collectorScrapeStatus.WithLabelValues("chassis").Set(float64(1))
+	// every metric has to be sent before Collect returns
+	tasks.Wait()
+	collectorLogContext.Info("collector scrape completed")
+
+	c.collectorScrapeStatus.WithLabelValues("chassis").Set(boolToFloat64(listed))
+	c.collectorScrapeStatus.Collect(ch)
 }
 
-func parseChassisTemperature(ch chan<- prometheus.Metric, chassisID string, chassisTemperature redfish.Temperature, wg *sync.WaitGroup) {
-	defer wg.Done()
+// parseChassisTemperature sends a member of the Temperatures of Thermal, sensor holds its reading and thresholds as
+// reported, with nulls.
+func parseChassisTemperature(ch chan<- prometheus.Metric, chassisID string, chassisTemperature redfish.Temperature, sensor legacySensor) {
 	chassisTemperatureSensorName := chassisTemperature.Name
 	chassisTemperatureSensorID := chassisTemperature.MemberID
 	chassisTemperatureStatus := chassisTemperature.Status
 	chassisTemperatureLabelvalues := []string{"temperature", chassisID, chassisTemperatureSensorName, chassisTemperatureSensorID}
 
-	chassisTemperatureStatusHealth :=chassisTemperatureStatus.Health
+	chassisTemperatureStatusHealth := chassisTemperatureStatus.Health
 	if chassisTemperatureStatusHealthValue, ok := parseCommonStatusHealth(chassisTemperatureStatusHealth); ok {
 		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_temperature_sensor_health"].desc, prometheus.GaugeValue, chassisTemperatureStatusHealthValue, chassisTemperatureLabelvalues...)
 	}
@@ -281,10 +373,11 @@ func parseChassisTemperature(ch chan<- prometheus.Metric, chassisID string, chas
 
 	chassisTemperatureReadingCelsius := chassisTemperature.ReadingCelsius
 	ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_temperature_celsius"].desc, prometheus.GaugeValue, float64(chassisTemperatureReadingCelsius), chassisTemperatureLabelvalues...)
+
+	parseSensorThresholds(ch, chassisMetrics, "chassis_temperature", "celsius", sensor.ReadingCelsius, chassisTemperatureStatusState, sensor.thresholds(), chassisTemperatureLabelvalues)
 }
 
-func parseChassisFan(ch chan<- prometheus.Metric, chassisID string, chassisFan redfish.Fan, wg *sync.WaitGroup) {
-	defer wg.Done()
+func parseChassisFan(ch chan<- prometheus.Metric, chassisID string, chassisFan redfish.Fan) {
 	chassisFanID := chassisFan.MemberID
 	chassisFanName := chassisFan.Name
 	chassisFanStaus := chassisFan.Status
@@ -333,8 +426,9 @@ func parseChassisFan(ch chan<- prometheus.Metric, chassisID string, chassisFan r
 	ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_fan_rpm_upper_threshold_fatal"].desc, prometheus.GaugeValue, chassisFanRPMUpperFatalThreshold, chassisFanLabelvalues...)
 }
 
-func parseChassisPowerInfoVoltage(ch chan<- prometheus.Metric, chassisID string, chassisPowerInfoVoltage redfish.Voltage, wg *sync.WaitGroup) {
-	defer wg.Done()
+// parseChassisPowerInfoVoltage sends a member of the Voltages of Power, sensor holds its reading and thresholds as
+// reported, with nulls.
+func parseChassisPowerInfoVoltage(ch chan<- prometheus.Metric, chassisID string, chassisPowerInfoVoltage redfish.Voltage, sensor legacySensor) {
 	chassisPowerInfoVoltageName := chassisPowerInfoVoltage.Name
 	chassisPowerInfoVoltageID := chassisPowerInfoVoltage.MemberID
 	chassisPowerInfoVoltageNameReadingVolts := chassisPowerInfoVoltage.ReadingVolts
@@ -344,19 +438,41 @@ func parseChassisPowerInfoVoltage(ch chan<- prometheus.Metric, chassisID string,
 		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_voltage_state"].desc, prometheus.GaugeValue, chassisPowerInfoVoltageStateValue, chassisPowerVoltageLabelvalues...)
 	}
 	ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_voltage_volts"].desc, prometheus.GaugeValue, float64(chassisPowerInfoVoltageNameReadingVolts), chassisPowerVoltageLabelvalues...)
+
+	parseSensorThresholds(ch, chassisMetrics, "chassis_power_voltage", "volts", sensor.ReadingVolts, chassisPowerInfoVoltageState, sensor.thresholds(), chassisPowerVoltageLabelvalues)
 }
 
-func parseChassisPowerInfoPowerControl(ch chan<- prometheus.Metric, chassisID string, chassisPowerInfoPowerControl redfish.PowerControl, wg *sync.WaitGroup) {
-	defer wg.Done()
+// parseChassisPowerInfoPowerControl sends the power consumption, allocation, limit and power metrics of a power
+// control, the limit is left out when none is set.
+func parseChassisPowerInfoPowerControl(ch chan<- prometheus.Metric, chassisID string, chassisPowerInfoPowerControl redfish.PowerControl) {
 	name := chassisPowerInfoPowerControl.Name
 	id := chassisPowerInfoPowerControl.MemberID
 	pm := chassisPowerInfoPowerControl.PowerMetrics
-	chassisPowerVoltageLabelvalues := []string{"power_wattage", chassisID, name, id}
-	ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_average_consumed_watts"].desc, prometheus.GaugeValue, float64(pm.AverageConsumedWatts), chassisPowerVoltageLabelvalues...)
+	pl := chassisPowerInfoPowerControl.PowerLimit
+	chassisPowerControlLabelvalues := []string{"power_control", chassisID, name, id}
+	ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_control_consumed_watts"].desc, prometheus.GaugeValue, float64(chassisPowerInfoPowerControl.PowerConsumedWatts), chassisPowerControlLabelvalues...)
+	ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_control_capacity_watts"].desc, prometheus.GaugeValue, float64(chassisPowerInfoPowerControl.PowerCapacityWatts), chassisPowerControlLabelvalues...)
+	ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_control_allocated_watts"].desc, prometheus.GaugeValue, float64(chassisPowerInfoPowerControl.PowerAllocatedWatts), chassisPowerControlLabelvalues...)
+	ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_control_requested_watts"].desc, prometheus.GaugeValue, float64(chassisPowerInfoPowerControl.PowerRequestedWatts), chassisPowerControlLabelvalues...)
+	ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_control_available_watts"].desc, prometheus.GaugeValue, float64(chassisPowerInfoPowerControl.PowerAvailableWatts), chassisPowerControlLabelvalues...)
+
+	if pl.LimitInWatts > 0 {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_control_limit_watts"].desc, prometheus.GaugeValue, float64(pl.LimitInWatts), chassisPowerControlLabelvalues...)
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_control_limit_correction_seconds"].desc, prometheus.GaugeValue, float64(pl.CorrectionInMs)/1000, chassisPowerControlLabelvalues...)
+		if chassisPowerLimitExceptionValue, ok := parsePowerLimitException(pl.LimitException); ok {
+			ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_control_limit_exception"].desc, prometheus.GaugeValue, chassisPowerLimitExceptionValue, chassisPowerControlLabelvalues...)
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_average_consumed_watts"].desc, prometheus.GaugeValue, float64(pm.AverageConsumedWatts), chassisPowerControlLabelvalues...)
+	if pm.IntervalInMin > 0 {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_control_min_consumed_watts"].desc, prometheus.GaugeValue, float64(pm.MinConsumedWatts), chassisPowerControlLabelvalues...)
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_control_max_consumed_watts"].desc, prometheus.GaugeValue, float64(pm.MaxConsumedWatts), chassisPowerControlLabelvalues...)
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_control_interval_seconds"].desc, prometheus.GaugeValue, float64(pm.IntervalInMin)*60, chassisPowerControlLabelvalues...)
+	}
 }
 
-func parseChassisPowerInfoPowerSupply(ch chan<- prometheus.Metric, chassisID string, chassisPowerInfoPowerSupply redfish.PowerSupply, wg *sync.WaitGroup) {
-	defer wg.Done()
+func parseChassisPowerInfoPowerSupply(ch chan<- prometheus.Metric, chassisID string, chassisPowerInfoPowerSupply redfish.PowerSupply) {
 	chassisPowerInfoPowerSupplyName := chassisPowerInfoPowerSupply.Name
 	chassisPowerInfoPowerSupplyID := chassisPowerInfoPowerSupply.MemberID
 	chassisPowerInfoPowerSupplyEfficiencyPercent := chassisPowerInfoPowerSupply.EfficiencyPercent
@@ -381,8 +497,7 @@ func parseChassisPowerInfoPowerSupply(ch chan<- prometheus.Metric, chassisID str
 	ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_powersupply_power_output_watts"].desc, prometheus.GaugeValue, float64(chassisPowerInfoPowerSupplyPowerOutputWatts), chassisPowerSupplyLabelvalues...)
 }
 
-func parseNetworkAdapter(ch chan<- prometheus.Metric, chassisID string, networkAdapter *redfish.NetworkAdapter, wg *sync.WaitGroup) error {
-	defer wg.Done()
+func parseNetworkAdapter(ch chan<- prometheus.Metric, chassisID string, networkAdapter *redfish.NetworkAdapter) error {
 	networkAdapterName := networkAdapter.Name
 	networkAdapterID := networkAdapter.ID
 	networkAdapterState := networkAdapter.Status.State
@@ -395,21 +510,17 @@ func parseNetworkAdapter(ch chan<- prometheus.Metric, chassisID string, networkA
 		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_network_adapter_health_state"].desc, prometheus.GaugeValue, networkAdapterHealthStateValue, chassisNetworkAdapterLabelValues...)
 	}
 
-	if networkPorts, err := networkAdapter.NetworkPorts(); err != nil {
+	networkPorts, err := networkAdapter.NetworkPorts()
+	if err != nil {
 		return err
-	} else {
-		wg6 := &sync.WaitGroup{}
-		wg6.Add(len(networkPorts))
-		for _, networkPort := range networkPorts {
-			go parseNetworkPort(ch, chassisID, networkPort, networkAdapterName, networkAdapterID, wg6)
-		}
-		wg6.Wait()
+	}
+	for _, networkPort := range networkPorts {
+		parseNetworkPort(ch, chassisID, networkPort, networkAdapterName, networkAdapterID)
 	}
 	return nil
 }
 
-func parseNetworkPort(ch chan<- prometheus.Metric, chassisID string, networkPort *redfish.NetworkPort, networkAdapterName string, networkAdapterID string, wg *sync.WaitGroup) {
-	defer wg.Done()
+func parseNetworkPort(ch chan<- prometheus.Metric, chassisID string, networkPort *redfish.NetworkPort, networkAdapterName string, networkAdapterID string) {
 	networkPortName := networkPort.Name
 	networkPortID := networkPort.ID
 	networkPortState := networkPort.Status.State
@@ -0,0 +1,108 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ChassisSensorLabelNames        = []string{"resource", "chassis_id", "sensor", "sensor_id", "physical_context", "physical_sub_context"}
+	ChassisSensorReadingLabelNames = []string{"resource", "chassis_id", "sensor", "sensor_id", "physical_context", "physical_sub_context", "reading_type", "reading_units"}
+)
+
+// sensorReadingType is the metric of the readings of the sensors with a ReadingType, in its base unit.
+type sensorReadingType struct {
+	// name is the metric name without the chassis_sensor_ prefix and the unit
+	name string
+	unit string
+	// scale converts the ReadingUnits the ReadingType mandates to unit
+	scale float64
+	// counter is set for the readings only ever increasing, they have no thresholds.
+	counter bool
+}
+
+// sensorReadingTypes maps the ReadingType of a Sensor to the metric of its readings, the readings of other types are
+// exported as redfish_chassis_sensor_reading.
+var sensorReadingTypes = map[string]sensorReadingType{
+	"Temperature":   {name: "temperature", unit: "celsius", scale: 1},
+	"Voltage":       {name: "voltage", unit: "volts", scale: 1},
+	"Current":       {name: "current", unit: "amperes", scale: 1},
+	"Power":         {name: "power", unit: "watts", scale: 1},
+	"EnergyJoules":  {name: "energy", unit: "joules", scale: 1, counter: true},
+	"EnergyWh":      {name: "energy", unit: "joules", scale: 3600, counter: true},
+	"EnergykWh":     {name: "energy", unit: "joules", scale: joulesPerKWh, counter: true},
+	"Humidity":      {name: "humidity", unit: "percent", scale: 1},
+	"Percent":       {name: "load", unit: "percent", scale: 1},
+	"Rotational":    {name: "rotational", unit: "rpm", scale: 1},
+	"Frequency":     {name: "frequency", unit: "hertz", scale: 1},
+	"PressurePa":    {name: "pressure", unit: "pascals", scale: 1},
+	"PressurekPa":   {name: "pressure", unit: "pascals", scale: 1000},
+	"Pressure":      {name: "pressure", unit: "pascals", scale: 1},
+	"LiquidFlow":    {name: "liquid_flow", unit: "liters_per_minute", scale: 60},
+	"LiquidFlowLPM": {name: "liquid_flow", unit: "liters_per_minute", scale: 1},
+	"AirFlowCMM":    {name: "air_flow", unit: "cubic_meters_per_minute", scale: 1},
+	"LiquidLevel":   {name: "liquid_level", unit: "centimeters", scale: 1},
+	"Altitude":      {name: "altitude", unit: "meters", scale: 1},
+}
+
+// metricKey returns the key of the readings of the reading type in the metric map.
+func (t sensorReadingType) metricKey() string {
+	if t.counter {
+		return fmt.Sprintf("%s_sensor_%s_%s_total", ChassisSubsystem, t.name, t.unit)
+	}
+	return fmt.Sprintf("%s_sensor_%s_%s", ChassisSubsystem, t.name, t.unit)
+}
+
+func addSensorsToMetricMap(chassisMetrics map[string]Metric) {
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "sensor_health", fmt.Sprintf("health of the sensor of the Sensors collection of the chassis,%s", CommonHealthHelp), ChassisSensorLabelNames)
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "sensor_state", fmt.Sprintf("state of the sensor of the Sensors collection of the chassis,%s", CommonStateHelp), ChassisSensorLabelNames)
+	addToMetricMap(chassisMetrics, ChassisSubsystem, "sensor_reading", "reading of the sensor of the Sensors collection of the chassis whose reading type has no metric of its own, in its reading units", ChassisSensorReadingLabelNames)
+
+	added := make(map[string]bool)
+	for _, readingType := range sensorReadingTypes {
+		if added[readingType.metricKey()] {
+			continue
+		}
+		added[readingType.metricKey()] = true
+		name := fmt.Sprintf("sensor_%s", readingType.name)
+		sensor := fmt.Sprintf("the %s sensor of the chassis", strings.Replace(readingType.name, "_", " ", -1))
+		if readingType.counter {
+			addToMetricMap(chassisMetrics, ChassisSubsystem, fmt.Sprintf("%s_%s_total", name, readingType.unit), fmt.Sprintf("reading of %s, in %s", sensor, readingType.unit), ChassisSensorLabelNames)
+			continue
+		}
+		addToMetricMap(chassisMetrics, ChassisSubsystem, fmt.Sprintf("%s_%s", name, readingType.unit), fmt.Sprintf("reading of %s, in %s", sensor, readingType.unit), ChassisSensorLabelNames)
+		addThresholdsToMetricMap(chassisMetrics, ChassisSubsystem, name, readingType.unit, sensor, ChassisSensorLabelNames)
+	}
+}
+
+// parseChassisSensor sends the status and reading of a member of the Sensors collection, converted to the base unit
+// of its reading type, along with its thresholds.
+func parseChassisSensor(ch chan<- prometheus.Metric, chassisID string, sensor *redfishSensor) {
+	chassisSensorLabelValues := []string{"sensor", chassisID, sensor.Name, sensor.ID, sensor.PhysicalContext, sensor.PhysicalSubContext}
+	if chassisSensorHealthValue, ok := parseCommonStatusHealth(sensor.Status.Health); ok {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_sensor_health"].desc, prometheus.GaugeValue, chassisSensorHealthValue, chassisSensorLabelValues...)
+	}
+	if chassisSensorStateValue, ok := parseCommonStatusState(sensor.Status.State); ok {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_sensor_state"].desc, prometheus.GaugeValue, chassisSensorStateValue, chassisSensorLabelValues...)
+	}
+	if sensor.Reading == nil {
+		return
+	}
+
+	readingType, ok := sensorReadingTypes[sensor.ReadingType]
+	if !ok {
+		chassisSensorReadingLabelValues := append(chassisSensorLabelValues, sensor.ReadingType, sensor.ReadingUnits)
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_sensor_reading"].desc, prometheus.GaugeValue, *sensor.Reading, chassisSensorReadingLabelValues...)
+		return
+	}
+	reading := *sensor.Reading * readingType.scale
+	if readingType.counter {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics[readingType.metricKey()].desc, prometheus.CounterValue, reading, chassisSensorLabelValues...)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(chassisMetrics[readingType.metricKey()].desc, prometheus.GaugeValue, reading, chassisSensorLabelValues...)
+
+	parseSensorThresholds(ch, chassisMetrics, fmt.Sprintf("%s_sensor_%s", ChassisSubsystem, readingType.name), readingType.unit, &reading, sensor.Status.State, sensor.thresholds().scaled(readingType.scale), chassisSensorLabelValues)
+}
@@ -0,0 +1,627 @@
+package collector
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	gofishcommon "github.com/stmcginnis/gofish/common"
+	"github.com/stmcginnis/gofish/redfish"
+)
+
+// The resources below were introduced by Redfish 2020.4 to replace Thermal and Power, gofish does not know them yet
+// so only the properties exported are decoded. Properties are pointers where null and absent differ from 0.
+
+// chassisSubsystemLinks are the links of a chassis to the newer power and thermal resources, and to the deprecated
+// ones.
+type chassisSubsystemLinks struct {
+	Thermal            gofishcommon.Link
+	Power              gofishcommon.Link
+	ThermalSubsystem   gofishcommon.Link
+	PowerSubsystem     gofishcommon.Link
+	EnvironmentMetrics gofishcommon.Link
+	Sensors            gofishcommon.Link
+}
+
+// sensorExcerpt is the excerpt of a Sensor embedded in another resource, e.g. the SpeedPercent of a fan.
+type sensorExcerpt struct {
+	DataSourceURI string `json:"DataSourceUri"`
+	Reading       *float64
+	SpeedRPM      *float64
+}
+
+// sensorArrayExcerpt is the excerpt of a Sensor in an array, e.g. the TemperatureReadingsCelsius of ThermalMetrics.
+type sensorArrayExcerpt struct {
+	DataSourceURI   string `json:"DataSourceUri"`
+	DeviceName      string
+	PhysicalContext string
+	Reading         *float64
+}
+
+type sensorThreshold struct {
+	Reading *float64
+}
+
+// redfishSensor is a member of the Sensors collection of a chassis.
+type redfishSensor struct {
+	ODataID            string `json:"@odata.id"`
+	ID                 string `json:"Id"`
+	Name               string
+	ReadingType        string
+	Reading            *float64
+	ReadingUnits       string
+	ReadingRangeMin    *float64
+	ReadingRangeMax    *float64
+	PhysicalContext    string
+	PhysicalSubContext string
+	Status             gofishcommon.Status
+	Thresholds         struct {
+		LowerCaution  sensorThreshold
+		UpperCaution  sensorThreshold
+		LowerCritical sensorThreshold
+		UpperCritical sensorThreshold
+		LowerFatal    sensorThreshold
+		UpperFatal    sensorThreshold
+	}
+}
+
+// thresholds returns the thresholds and reading range of the sensor, the caution thresholds of a Sensor are the
+// non critical thresholds of Thermal and Power.
+func (s *redfishSensor) thresholds() sensorThresholds {
+	return sensorThresholds{
+		LowerNonCritical: s.Thresholds.LowerCaution.Reading,
+		UpperNonCritical: s.Thresholds.UpperCaution.Reading,
+		LowerCritical:    s.Thresholds.LowerCritical.Reading,
+		UpperCritical:    s.Thresholds.UpperCritical.Reading,
+		LowerFatal:       s.Thresholds.LowerFatal.Reading,
+		UpperFatal:       s.Thresholds.UpperFatal.Reading,
+		MinReadingRange:  s.ReadingRangeMin,
+		MaxReadingRange:  s.ReadingRangeMax,
+	}
+}
+
+// legacySensor is the reading and thresholds of a member of the Temperatures of Thermal or the Voltages of Power,
+// gofish decodes them as 0 when they are null.
+type legacySensor struct {
+	ReadingCelsius            *float64
+	ReadingVolts              *float64
+	LowerThresholdNonCritical *float64
+	UpperThresholdNonCritical *float64
+	LowerThresholdCritical    *float64
+	UpperThresholdCritical    *float64
+	LowerThresholdFatal       *float64
+	UpperThresholdFatal       *float64
+	MinReadingRangeTemp       *float64
+	MaxReadingRangeTemp       *float64
+	MinReadingRange           *float64
+	MaxReadingRange           *float64
+}
+
+// thresholds returns the thresholds and reading range of the sensor, temperatures name their reading range
+// differently.
+func (s *legacySensor) thresholds() sensorThresholds {
+	thresholds := sensorThresholds{
+		LowerNonCritical: s.LowerThresholdNonCritical,
+		UpperNonCritical: s.UpperThresholdNonCritical,
+		LowerCritical:    s.LowerThresholdCritical,
+		UpperCritical:    s.UpperThresholdCritical,
+		LowerFatal:       s.LowerThresholdFatal,
+		UpperFatal:       s.UpperThresholdFatal,
+		MinReadingRange:  s.MinReadingRange,
+		MaxReadingRange:  s.MaxReadingRange,
+	}
+	if s.MinReadingRangeTemp != nil || s.MaxReadingRangeTemp != nil {
+		thresholds.MinReadingRange = s.MinReadingRangeTemp
+		thresholds.MaxReadingRange = s.MaxReadingRangeTemp
+	}
+	return thresholds
+}
+
+type thermalSubsystem struct {
+	Fans           gofishcommon.Link
+	ThermalMetrics gofishcommon.Link
+}
+
+type subsystemFan struct {
+	ID           string `json:"Id"`
+	Name         string
+	Status       gofishcommon.Status
+	SpeedPercent sensorExcerpt
+}
+
+type thermalMetrics struct {
+	TemperatureReadingsCelsius []sensorArrayExcerpt
+}
+
+type powerSubsystem struct {
+	PowerSupplies gofishcommon.Link
+}
+
+type subsystemPowerSupply struct {
+	ID                 string `json:"Id"`
+	Name               string
+	Status             gofishcommon.Status
+	PowerCapacityWatts *float64
+	EfficiencyRatings  []struct {
+		EfficiencyPercent *float64
+	}
+	Metrics gofishcommon.Link
+}
+
+type powerSupplyMetrics struct {
+	InputPowerWatts  sensorExcerpt
+	OutputPowerWatts sensorExcerpt
+	EnergykWh        sensorExcerpt
+}
+
+type environmentMetrics struct {
+	PowerWatts sensorExcerpt
+	EnergykWh  sensorExcerpt
+}
+
+// chassisResources gets the links of a chassis to the newer resources and its Sensors collection once, for the
+// thermal and power tasks of the chassis sharing them.
+type chassisResources struct {
+	client  gofishcommon.Client
+	chassis *redfish.Chassis
+
+	linksOnce sync.Once
+	links     chassisSubsystemLinks
+	linksErr  error
+
+	sensorsOnce sync.Once
+	sensors     []*redfishSensor
+	sensorsErr  error
+}
+
+func newChassisResources(client gofishcommon.Client, chassis *redfish.Chassis) *chassisResources {
+	return &chassisResources{client: client, chassis: chassis}
+}
+
+// subsystemLinks returns the links of the chassis to the newer resources, gofish drops them so the chassis is
+// fetched again.
+func (r *chassisResources) subsystemLinks() (chassisSubsystemLinks, error) {
+	r.linksOnce.Do(func() {
+		r.linksErr = getJSON(r.client, r.chassis.ODataID, &r.links)
+	})
+	return r.links, r.linksErr
+}
+
+// thermal returns the deprecated Thermal resource of the chassis along with the readings and thresholds of its
+// Temperatures, in the same order. It returns nil when the chassis has no Thermal resource or it is not found.
+func (r *chassisResources) thermal() (*redfish.Thermal, []legacySensor, error) {
+	links, err := r.subsystemLinks()
+	if err != nil || links.Thermal == "" {
+		return nil, nil, err
+	}
+	var thermal redfish.Thermal
+	var sensors struct {
+		Temperatures []legacySensor
+	}
+	if err := getJSONInto(r.client, string(links.Thermal), &thermal, &sensors); err != nil {
+		if isNotFound(err) {
+			// BMCs dropping the deprecated resource may still link it
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	thermal.SetClient(r.client)
+	return &thermal, sensors.Temperatures, nil
+}
+
+// legacyPower is the readings of the deprecated Power resource that gofish decodes as 0 when they are null.
+type legacyPower struct {
+	Voltages     []legacySensor
+	PowerControl []struct {
+		PowerConsumedWatts *float64
+	}
+}
+
+// consumedWatts returns the power consumption of the whole chassis, the one of its first power control, nil when
+// there is none.
+func (p *legacyPower) consumedWatts() *float64 {
+	if p == nil || len(p.PowerControl) == 0 {
+		return nil
+	}
+	return p.PowerControl[0].PowerConsumedWatts
+}
+
+// power returns the deprecated Power resource of the chassis along with the readings and thresholds of its Voltages
+// and PowerControl, in the same order. It returns nil when the chassis has no Power resource or it is not found.
+func (r *chassisResources) power() (*redfish.Power, *legacyPower, error) {
+	links, err := r.subsystemLinks()
+	if err != nil || links.Power == "" {
+		return nil, nil, err
+	}
+	var power redfish.Power
+	var readings legacyPower
+	if err := getJSONInto(r.client, string(links.Power), &power, &readings); err != nil {
+		if isNotFound(err) {
+			// BMCs dropping the deprecated resource may still link it
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	power.SetClient(r.client)
+	return &power, &readings, nil
+}
+
+// isNotFound returns whether err is the answer of the service to a request for a resource it does not have.
+func isNotFound(err error) bool {
+	var redfishErr *gofishcommon.Error
+	return errors.As(err, &redfishErr) && redfishErr.HTTPReturnedStatusCode == http.StatusNotFound
+}
+
+// legacySensorAt returns the sensor at index i, one without readings or thresholds when there is none.
+func legacySensorAt(sensors []legacySensor, i int) legacySensor {
+	if i < len(sensors) {
+		return sensors[i]
+	}
+	return legacySensor{}
+}
+
+// allSensors returns the members of the Sensors collection of the chassis, none when it has no collection.
+func (r *chassisResources) allSensors() ([]*redfishSensor, error) {
+	r.sensorsOnce.Do(func() {
+		links, err := r.subsystemLinks()
+		if err != nil {
+			r.sensorsErr = err
+			return
+		}
+		if links.Sensors == "" {
+			return
+		}
+		var mu sync.Mutex
+		r.sensorsErr = getMembers(r.client, string(links.Sensors), func(link string) error {
+			var sensor redfishSensor
+			if err := getJSON(r.client, link, &sensor); err != nil {
+				return err
+			}
+			mu.Lock()
+			r.sensors = append(r.sensors, &sensor)
+			mu.Unlock()
+			return nil
+		})
+	})
+	return r.sensors, r.sensorsErr
+}
+
+// sensorsOfType returns the sensors of the chassis with the reading type, e.g. Temperature.
+func (r *chassisResources) sensorsOfType(readingType string) ([]*redfishSensor, error) {
+	all, err := r.allSensors()
+	var sensors []*redfishSensor
+	for _, sensor := range all {
+		if sensor.ReadingType == readingType {
+			sensors = append(sensors, sensor)
+		}
+	}
+	return sensors, err
+}
+
+// hasEnergySensor returns whether the Sensors collection of the chassis has an energy reading, or may have one when it
+// could not be got in full.
+func (r *chassisResources) hasEnergySensor() bool {
+	sensors, err := r.allSensors()
+	if err != nil {
+		return true
+	}
+	for _, sensor := range sensors {
+		if readingType, ok := sensorReadingTypes[sensor.ReadingType]; ok && readingType.name == "energy" && sensor.Reading != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// subsystemReadingTypes returns the reading types of the sensors that the thermal and power resources, when enabled,
+// export from the Sensors collection of a chassis with the newer subsystems.
+func (r *chassisResources) subsystemReadingTypes(thermal, power bool) map[string]bool {
+	readingTypes := make(map[string]bool)
+	links, err := r.subsystemLinks()
+	if err != nil || links.Sensors == "" {
+		return readingTypes
+	}
+	if thermal && links.ThermalSubsystem != "" {
+		readingTypes["Temperature"] = true
+	}
+	if power && (links.PowerSubsystem != "" || links.EnvironmentMetrics != "") {
+		readingTypes["Voltage"] = true
+	}
+	return readingTypes
+}
+
+// getMembers lists the collection at uri and calls get with the link of every member, three at a time like gofish
+// does. The members that could not be got are returned as a CollectionError.
+func getMembers(client gofishcommon.Client, uri string, get func(link string) error) error {
+	collection, err := gofishcommon.GetCollection(client, uri)
+	if err != nil {
+		return err
+	}
+	var mu sync.Mutex
+	collectionError := gofishcommon.NewCollectionError()
+	gofishcommon.CollectCollection(func(link string) {
+		if err := get(link); err != nil {
+			mu.Lock()
+			collectionError.Failures[link] = err
+			mu.Unlock()
+		}
+	}, client, collection.ItemLinks)
+	if !collectionError.Empty() {
+		return collectionError
+	}
+	return nil
+}
+
+// collectThermalSubsystem sends the temperatures and fans of a chassis with a ThermalSubsystem, the temperatures
+// come from the Sensors collection or, without one, from the ThermalMetrics. It returns false when the chassis has
+// no ThermalSubsystem or it could not be got, nothing has been sent then.
+func (c *ChassisCollector) collectThermalSubsystem(ch chan<- prometheus.Metric, chassisID string, resources *chassisResources) bool {
+	chassisLogContext := c.Log.WithField("Chassis", chassisID)
+	links, err := resources.subsystemLinks()
+	if err != nil {
+		chassisLogContext.WithField("operation", "chassis.ThermalSubsystem()").WithError(err).Error("error getting chassis links, falling back to the thermal data")
+		c.scrapeErrors.add("chassis", "chassis.ThermalSubsystem()")
+		return false
+	}
+	if links.ThermalSubsystem == "" {
+		return false
+	}
+	var subsystem thermalSubsystem
+	if err := getJSON(c.redfishClient, string(links.ThermalSubsystem), &subsystem); err != nil {
+		chassisLogContext.WithField("operation", "chassis.ThermalSubsystem()").WithError(err).Error("error getting thermal subsystem from chassis, falling back to the thermal data")
+		c.scrapeErrors.add("chassis", "chassis.ThermalSubsystem()")
+		return false
+	}
+
+	if links.Sensors != "" {
+		sensors, err := resources.sensorsOfType("Temperature")
+		if err != nil {
+			chassisLogContext.WithField("operation", "chassis.Sensors()").WithError(err).Error("error getting sensors from chassis")
+			c.scrapeErrors.add("chassis", "chassis.Sensors()")
+		}
+		for _, sensor := range sensors {
+			parseChassisSensorTemperature(ch, chassisID, sensor)
+		}
+	} else if subsystem.ThermalMetrics != "" {
+		var metrics thermalMetrics
+		if err := getJSON(c.redfishClient, string(subsystem.ThermalMetrics), &metrics); err != nil {
+			chassisLogContext.WithField("operation", "chassis.ThermalMetrics()").WithError(err).Error("error getting thermal metrics from chassis")
+			c.scrapeErrors.add("chassis", "chassis.ThermalMetrics()")
+		}
+		for i, reading := range metrics.TemperatureReadingsCelsius {
+			parseChassisThermalMetricsTemperature(ch, chassisID, i, reading)
+		}
+	}
+
+	if subsystem.Fans != "" {
+		var mu sync.Mutex
+		err := getMembers(c.redfishClient, string(subsystem.Fans), func(link string) error {
+			var fan subsystemFan
+			if err := getJSON(c.redfishClient, link, &fan); err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			parseChassisSubsystemFan(ch, chassisID, &fan)
+			return nil
+		})
+		if err != nil {
+			chassisLogContext.WithField("operation", "chassis.ThermalSubsystem().Fans()").WithError(err).Error("error getting fans from thermal subsystem")
+			c.scrapeErrors.add("chassis", "chassis.ThermalSubsystem().Fans()")
+		}
+	}
+	return true
+}
+
+// collectPowerSubsystem sends the power supplies, voltages and power consumption of a chassis with a PowerSubsystem
+// or EnvironmentMetrics, the voltages come from the Sensors collection. The power controls of the deprecated Power
+// resource are sent as well, the power consumption of EnvironmentMetrics only stands in for them when there are none.
+// consumedWatts is the power consumption of the power controls, the energy is estimated from it when EnvironmentMetrics
+// has none. It returns false when the chassis has neither or they could not be got, nothing has been sent then.
+func (c *ChassisCollector) collectPowerSubsystem(ch chan<- prometheus.Metric, chassisID string, resources *chassisResources, powerControls []redfish.PowerControl, consumedWatts *float64) bool {
+	chassisLogContext := c.Log.WithField("Chassis", chassisID)
+	links, err := resources.subsystemLinks()
+	if err != nil {
+		chassisLogContext.WithField("operation", "chassis.PowerSubsystem()").WithError(err).Error("error getting chassis links, falling back to the power data")
+		c.scrapeErrors.add("chassis", "chassis.PowerSubsystem()")
+		return false
+	}
+	if links.PowerSubsystem == "" && links.EnvironmentMetrics == "" {
+		return false
+	}
+	var subsystem powerSubsystem
+	if links.PowerSubsystem != "" {
+		if err := getJSON(c.redfishClient, string(links.PowerSubsystem), &subsystem); err != nil {
+			chassisLogContext.WithField("operation", "chassis.PowerSubsystem()").WithError(err).Error("error getting power subsystem from chassis, falling back to the power data")
+			c.scrapeErrors.add("chassis", "chassis.PowerSubsystem()")
+			return false
+		}
+	}
+	var environment environmentMetrics
+	if links.EnvironmentMetrics != "" {
+		if err := getJSON(c.redfishClient, string(links.EnvironmentMetrics), &environment); err != nil {
+			chassisLogContext.WithField("operation", "chassis.EnvironmentMetrics()").WithError(err).Error("error getting environment metrics from chassis, falling back to the power data")
+			c.scrapeErrors.add("chassis", "chassis.EnvironmentMetrics()")
+			return false
+		}
+		parseChassisEnvironmentMetrics(ch, chassisID, &environment, len(powerControls) == 0)
+	}
+	for _, powerControl := range powerControls {
+		parseChassisPowerInfoPowerControl(ch, chassisID, powerControl)
+	}
+
+	if links.Sensors != "" {
+		sensors, err := resources.sensorsOfType("Voltage")
+		if err != nil {
+			chassisLogContext.WithField("operation", "chassis.Sensors()").WithError(err).Error("error getting sensors from chassis")
+			c.scrapeErrors.add("chassis", "chassis.Sensors()")
+		}
+		for _, sensor := range sensors {
+			parseChassisSensorVoltage(ch, chassisID, sensor)
+		}
+	}
+
+	powerSupplyEnergy := false
+	if subsystem.PowerSupplies != "" {
+		var mu sync.Mutex
+		err := getMembers(c.redfishClient, string(subsystem.PowerSupplies), func(link string) error {
+			var powerSupply subsystemPowerSupply
+			if err := getJSON(c.redfishClient, link, &powerSupply); err != nil {
+				return err
+			}
+			var metrics powerSupplyMetrics
+			if powerSupply.Metrics != "" {
+				if err := getJSON(c.redfishClient, string(powerSupply.Metrics), &metrics); err != nil {
+					return err
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if parseChassisSubsystemPowerSupply(ch, chassisID, &powerSupply, &metrics) {
+				powerSupplyEnergy = true
+			}
+			return nil
+		})
+		if err != nil {
+			chassisLogContext.WithField("operation", "chassis.PowerSubsystem().PowerSupplies()").WithError(err).Error("error getting power supplies from power subsystem")
+			c.scrapeErrors.add("chassis", "chassis.PowerSubsystem().PowerSupplies()")
+		}
+	}
+
+	watts := environment.PowerWatts.Reading
+	if watts == nil {
+		watts = consumedWatts
+	}
+	c.parseChassisEnergyEstimate(ch, chassisID, resources, environment.EnergykWh.Reading != nil || powerSupplyEnergy, watts)
+	return true
+}
+
+func parseChassisSensorTemperature(ch chan<- prometheus.Metric, chassisID string, sensor *redfishSensor) {
+	chassisTemperatureLabelvalues := []string{"temperature", chassisID, sensor.Name, sensor.ID}
+	if chassisTemperatureStatusHealthValue, ok := parseCommonStatusHealth(sensor.Status.Health); ok {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_temperature_sensor_health"].desc, prometheus.GaugeValue, chassisTemperatureStatusHealthValue, chassisTemperatureLabelvalues...)
+	}
+	if chassisTemperatureStatusStateValue, ok := parseCommonStatusState(sensor.Status.State); ok {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_temperature_sensor_state"].desc, prometheus.GaugeValue, chassisTemperatureStatusStateValue, chassisTemperatureLabelvalues...)
+	}
+	if sensor.Reading != nil {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_temperature_celsius"].desc, prometheus.GaugeValue, *sensor.Reading, chassisTemperatureLabelvalues...)
+		parseSensorThresholds(ch, chassisMetrics, "chassis_temperature", "celsius", sensor.Reading, sensor.Status.State, sensor.thresholds(), chassisTemperatureLabelvalues)
+	}
+}
+
+// parseChassisThermalMetricsTemperature sends a temperature of the ThermalMetrics, its ID is the last segment of its
+// sensor URI or its index when it has none.
+func parseChassisThermalMetricsTemperature(ch chan<- prometheus.Metric, chassisID string, index int, reading sensorArrayExcerpt) {
+	if reading.Reading == nil {
+		return
+	}
+	sensorID := path.Base(strings.TrimSuffix(reading.DataSourceURI, "/"))
+	if reading.DataSourceURI == "" {
+		sensorID = strconv.Itoa(index)
+	}
+	chassisTemperatureLabelvalues := []string{"temperature", chassisID, reading.DeviceName, sensorID}
+	ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_temperature_celsius"].desc, prometheus.GaugeValue, *reading.Reading, chassisTemperatureLabelvalues...)
+}
+
+// parseChassisSubsystemFan sends a fan of the ThermalSubsystem, its speed is in RPM when the BMC reports it and in
+// percent otherwise, as the fan_unit label tells.
+func parseChassisSubsystemFan(ch chan<- prometheus.Metric, chassisID string, fan *subsystemFan) {
+	unit := redfish.PercentReadingUnits
+	reading := fan.SpeedPercent.Reading
+	if fan.SpeedPercent.SpeedRPM != nil {
+		unit = redfish.RPMReadingUnits
+		reading = fan.SpeedPercent.SpeedRPM
+	}
+	chassisFanLabelvalues := []string{"fan", chassisID, fan.Name, fan.ID, strings.ToLower(string(unit))}
+
+	if chassisFanStausHealthValue, ok := parseCommonStatusHealth(fan.Status.Health); ok {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_fan_health"].desc, prometheus.GaugeValue, chassisFanStausHealthValue, chassisFanLabelvalues...)
+	}
+	if chassisFanStausStateValue, ok := parseCommonStatusState(fan.Status.State); ok {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_fan_state"].desc, prometheus.GaugeValue, chassisFanStausStateValue, chassisFanLabelvalues...)
+	}
+	if reading != nil {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_fan_rpm"].desc, prometheus.GaugeValue, *reading, chassisFanLabelvalues...)
+	}
+	if fan.SpeedPercent.Reading != nil {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_fan_rpm_percentage"].desc, prometheus.GaugeValue, *fan.SpeedPercent.Reading, chassisFanLabelvalues...)
+	}
+}
+
+func parseChassisSensorVoltage(ch chan<- prometheus.Metric, chassisID string, sensor *redfishSensor) {
+	chassisPowerVoltageLabelvalues := []string{"power_voltage", chassisID, sensor.Name, sensor.ID}
+	if chassisPowerInfoVoltageStateValue, ok := parseCommonStatusState(sensor.Status.State); ok {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_voltage_state"].desc, prometheus.GaugeValue, chassisPowerInfoVoltageStateValue, chassisPowerVoltageLabelvalues...)
+	}
+	if sensor.Reading != nil {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_voltage_volts"].desc, prometheus.GaugeValue, *sensor.Reading, chassisPowerVoltageLabelvalues...)
+		parseSensorThresholds(ch, chassisMetrics, "chassis_power_voltage", "volts", sensor.Reading, sensor.Status.State, sensor.thresholds(), chassisPowerVoltageLabelvalues)
+	}
+}
+
+// parseChassisEnvironmentMetrics sends the energy consumption of the chassis and, with powerControl set, its power
+// consumption as the power control named EnvironmentMetrics, standing in for the PowerControl of Power.
+func parseChassisEnvironmentMetrics(ch chan<- prometheus.Metric, chassisID string, environment *environmentMetrics, powerControl bool) {
+	if powerControl && environment.PowerWatts.Reading != nil {
+		chassisPowerControlLabelvalues := []string{"power_control", chassisID, "EnvironmentMetrics", "EnvironmentMetrics"}
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_average_consumed_watts"].desc, prometheus.GaugeValue, *environment.PowerWatts.Reading, chassisPowerControlLabelvalues...)
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_control_consumed_watts"].desc, prometheus.GaugeValue, *environment.PowerWatts.Reading, chassisPowerControlLabelvalues...)
+	}
+	if environment.EnergykWh.Reading != nil {
+		chassisEnergyLabelvalues := []string{"energy", chassisID}
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_energy_consumed_joules_total"].desc, prometheus.CounterValue, *environment.EnergykWh.Reading*joulesPerKWh, chassisEnergyLabelvalues...)
+	}
+}
+
+// parseChassisEnergyEstimate integrates the power consumption of a chassis without an energy counter over the polls
+// of the target, counter tells whether the power resources sent one. Nothing is sent when the target is not polled,
+// the chassis has an energy counter or no power reading, the poll is not integrated then.
+func (c *ChassisCollector) parseChassisEnergyEstimate(ch chan<- prometheus.Metric, chassisID string, resources *chassisResources, counter bool, watts *float64) {
+	estimate := c.options.energyEstimate()
+	if estimate == nil || counter || watts == nil {
+		return
+	}
+	// the energy sensors of the Sensors collection are sent by the sensors resource
+	if c.options.resourceEnabled("chassis", "sensors") && resources.hasEnergySensor() {
+		return
+	}
+	chassisEnergyLabelvalues := []string{"energy", chassisID}
+	ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_energy_estimated_joules_total"].desc, prometheus.CounterValue, estimate.add(chassisID, *watts, time.Now()), chassisEnergyLabelvalues...)
+}
+
+// parseChassisSubsystemPowerSupply sends a power supply of the PowerSubsystem, the output power of its metrics stands
+// for both the last and the current output power of Power. It returns whether the energy counter of the power supply
+// was sent.
+func parseChassisSubsystemPowerSupply(ch chan<- prometheus.Metric, chassisID string, powerSupply *subsystemPowerSupply, metrics *powerSupplyMetrics) bool {
+	chassisPowerSupplyLabelvalues := []string{"power_supply", chassisID, powerSupply.Name, powerSupply.ID}
+	if chassisPowerInfoPowerSupplyStateValue, ok := parseCommonStatusState(powerSupply.Status.State); ok {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_powersupply_state"].desc, prometheus.GaugeValue, chassisPowerInfoPowerSupplyStateValue, chassisPowerSupplyLabelvalues...)
+	}
+	if chassisPowerInfoPowerSupplyHealthValue, ok := parseCommonStatusHealth(powerSupply.Status.Health); ok {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_powersupply_health"].desc, prometheus.GaugeValue, chassisPowerInfoPowerSupplyHealthValue, chassisPowerSupplyLabelvalues...)
+	}
+	if len(powerSupply.EfficiencyRatings) > 0 && powerSupply.EfficiencyRatings[0].EfficiencyPercent != nil {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_powersupply_power_efficiency_percentage"].desc, prometheus.GaugeValue, *powerSupply.EfficiencyRatings[0].EfficiencyPercent, chassisPowerSupplyLabelvalues...)
+	}
+	if powerSupply.PowerCapacityWatts != nil {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_powersupply_power_capacity_watts"].desc, prometheus.GaugeValue, *powerSupply.PowerCapacityWatts, chassisPowerSupplyLabelvalues...)
+	}
+	if metrics.InputPowerWatts.Reading != nil {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_powersupply_power_input_watts"].desc, prometheus.GaugeValue, *metrics.InputPowerWatts.Reading, chassisPowerSupplyLabelvalues...)
+	}
+	if metrics.OutputPowerWatts.Reading != nil {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_powersupply_power_output_watts"].desc, prometheus.GaugeValue, *metrics.OutputPowerWatts.Reading, chassisPowerSupplyLabelvalues...)
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_powersupply_last_power_output_watts"].desc, prometheus.GaugeValue, *metrics.OutputPowerWatts.Reading, chassisPowerSupplyLabelvalues...)
+	}
+	if metrics.EnergykWh.Reading != nil {
+		ch <- prometheus.MustNewConstMetric(chassisMetrics["chassis_power_powersupply_energy_joules_total"].desc, prometheus.CounterValue, *metrics.EnergykWh.Reading*joulesPerKWh, chassisPowerSupplyLabelvalues...)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	gofish "github.com/stmcginnis/gofish"
+	"github.com/stmcginnis/gofish/redfish"
+)
+
+func TestChassisResourcesLegacy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redfish/v1/":
+			fmt.Fprint(w, `{"@odata.id": "/redfish/v1/"}`)
+		case "/redfish/v1/Chassis/1":
+			fmt.Fprint(w, `{"@odata.id": "/redfish/v1/Chassis/1", "Id": "1", "Thermal": {"@odata.id": "/redfish/v1/Chassis/1/Thermal"}, "Power": {"@odata.id": "/redfish/v1/Chassis/1/Power"}}`)
+		case "/redfish/v1/Chassis/1/Thermal":
+			fmt.Fprint(w, `{"@odata.id": "/redfish/v1/Chassis/1/Thermal", "Temperatures": [{"MemberId": "0", "ReadingCelsius": null, "LowerThresholdCritical": 0, "UpperThresholdCritical": 85}]}`)
+		case "/redfish/v1/Chassis/2":
+			fmt.Fprint(w, `{"@odata.id": "/redfish/v1/Chassis/2", "Id": "2", "Power": {"@odata.id": "/redfish/v1/Chassis/2/Power"}}`)
+		case "/redfish/v1/Chassis/2/Power":
+			fmt.Fprint(w, `{"@odata.id": "/redfish/v1/Chassis/2/Power", "PowerControl": [{"MemberId": "0", "PowerConsumedWatts": null}]}`)
+		default:
+			// the Power resource is still linked but no longer served
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client, err := gofish.ConnectContext(context.Background(), gofish.ClientConfig{Endpoint: server.URL, HTTPClient: server.Client()})
+	if err != nil {
+		t.Fatalf("ConnectContext() = %s", err)
+	}
+	chassis := &redfish.Chassis{}
+	chassis.ODataID = "/redfish/v1/Chassis/1"
+	resources := newChassisResources(client, chassis)
+
+	power, readings, err := resources.power()
+	if power != nil || readings != nil || err != nil {
+		t.Errorf("power() of a Power resource not found = %v, %v, %v, want none and no error", power, readings, err)
+	}
+
+	chassis = &redfish.Chassis{}
+	chassis.ODataID = "/redfish/v1/Chassis/2"
+	power, readings, err = newChassisResources(client, chassis).power()
+	if err != nil {
+		t.Fatalf("power() = %s", err)
+	}
+	if len(power.PowerControl) != 1 || readings.consumedWatts() != nil {
+		t.Errorf("power() = %d power controls consuming %v, want 1 with a null reading", len(power.PowerControl), readings.consumedWatts())
+	}
+
+	thermal, temperatures, err := resources.thermal()
+	if err != nil {
+		t.Fatalf("thermal() = %s", err)
+	}
+	if len(thermal.Temperatures) != 1 || len(temperatures) != 1 {
+		t.Fatalf("thermal() = %d temperatures, %d sensors, want 1", len(thermal.Temperatures), len(temperatures))
+	}
+	thresholds := temperatures[0].thresholds()
+	if temperatures[0].ReadingCelsius != nil || thresholds.LowerCritical == nil || *thresholds.LowerCritical != 0 || thresholds.UpperFatal != nil {
+		t.Errorf("thermal() sensor = %+v, want a null reading, a lower critical threshold of 0 and no fatal ones", temperatures[0])
+	}
+}
+
+func TestParseChassisEnergyEstimate(t *testing.T) {
+	watts := 100.0
+	tests := []struct {
+		name    string
+		counter bool
+		sensors []*redfishSensor
+		exclude []string
+		watts   *float64
+		want    bool
+	}{
+		{name: "without energy counter", watts: &watts, want: true},
+		{name: "null power reading", watts: nil},
+		{name: "energy counter of the power resources", counter: true, watts: &watts},
+		{name: "energy sensor", sensors: []*redfishSensor{{ReadingType: "EnergykWh", Reading: &watts}}, watts: &watts},
+		{name: "energy sensor without reading", sensors: []*redfishSensor{{ReadingType: "EnergyJoules"}}, watts: &watts, want: true},
+		{name: "other sensor", sensors: []*redfishSensor{{ReadingType: "Power", Reading: &watts}}, watts: &watts, want: true},
+		{name: "energy sensor not exported", sensors: []*redfishSensor{{ReadingType: "EnergyWh", Reading: &watts}}, exclude: []string{"sensors"}, watts: &watts, want: true},
+	}
+	for _, test := range tests {
+		resources := &chassisResources{sensors: test.sensors}
+		// the sensors are got already
+		resources.sensorsOnce.Do(func() {})
+		c := &ChassisCollector{options: &ScrapeOptions{Exclude: test.exclude, Energy: NewEnergyEstimate()}}
+		ch := make(chan prometheus.Metric, 1)
+		c.parseChassisEnergyEstimate(ch, "1", resources, test.counter, test.watts)
+		if sent := len(ch) == 1; sent != test.want {
+			t.Errorf("%s: estimate sent = %t, want %t", test.name, sent, test.want)
+		}
+	}
+}
@@ -2,9 +2,11 @@ package collector
 
 import (
 	"fmt"
-	"sync"
+	"sort"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	gofishcommon "github.com/stmcginnis/gofish/common"
 	"github.com/stmcginnis/gofish/redfish"
 )
 
@@ -15,6 +17,8 @@ const (
 	CommonLinkHelp            = "1(LinkUp),2(NoLink),3(LinkDown)"
 	CommonPortLinkHelp        = "1(Up),0(Down)"
 	CommonIntrusionSensorHelp = "1(Normal),2(TamperingDetected),3(HardwareIntrusion)"
+	CommonThresholdBandHelp   = "0(Normal),1(LowerNonCritical),2(UpperNonCritical),3(LowerCritical),4(UpperCritical),5(LowerFatal),6(UpperFatal)"
+	CommonLimitExceptionHelp  = "1(NoAction),2(HardPowerOff),3(LogEventOnly),4(Oem)"
 )
 
 type Metric struct {
@@ -33,8 +37,106 @@ func addToMetricMap(metricMap map[string]Metric, subsystem, name, help string, v
 	}
 }
 
-func parseLogService(ch chan<- prometheus.Metric, metrics map[string]Metric, subsystem, collectorID string, logService *redfish.LogService, wg *sync.WaitGroup) (err error) {
-	defer wg.Done()
+// sensorThresholds holds the thresholds and reading range of a sensor, a value is nil when the sensor does not report
+// it.
+type sensorThresholds struct {
+	LowerNonCritical *float64
+	UpperNonCritical *float64
+	LowerCritical    *float64
+	UpperCritical    *float64
+	LowerFatal       *float64
+	UpperFatal       *float64
+	MinReadingRange  *float64
+	MaxReadingRange  *float64
+}
+
+// scaled returns the thresholds multiplied by scale.
+func (t sensorThresholds) scaled(scale float64) sensorThresholds {
+	for _, threshold := range []**float64{&t.LowerNonCritical, &t.UpperNonCritical, &t.LowerCritical, &t.UpperCritical, &t.LowerFatal, &t.UpperFatal, &t.MinReadingRange, &t.MaxReadingRange} {
+		if *threshold != nil {
+			value := **threshold * scale
+			*threshold = &value
+		}
+	}
+	return t
+}
+
+// band returns the threshold band the reading is in, see CommonThresholdBandHelp, the most severe one when several
+// thresholds are crossed. ok is false when the sensor reports no thresholds.
+func (t sensorThresholds) band(reading float64) (band float64, ok bool) {
+	bands := []struct {
+		threshold *float64
+		upper     bool
+		band      float64
+	}{
+		{t.UpperFatal, true, 6},
+		{t.LowerFatal, false, 5},
+		{t.UpperCritical, true, 4},
+		{t.LowerCritical, false, 3},
+		{t.UpperNonCritical, true, 2},
+		{t.LowerNonCritical, false, 1},
+	}
+	for _, b := range bands {
+		if b.threshold == nil {
+			continue
+		}
+		ok = true
+		if b.upper && reading >= *b.threshold || !b.upper && reading <= *b.threshold {
+			return b.band, true
+		}
+	}
+	return 0, ok
+}
+
+// addThresholdsToMetricMap adds the threshold, reading range and threshold band metrics of the sensor metric name,
+// the thresholds are in unit. sensor describes the sensor in the help texts.
+func addThresholdsToMetricMap(metricMap map[string]Metric, subsystem, name, unit, sensor string, variableLabels []string) {
+	for _, threshold := range []struct{ name, help string }{
+		{"lower_threshold_non_critical", "threshold below the normal range, but not critical,"},
+		{"upper_threshold_non_critical", "threshold above the normal range, but not critical,"},
+		{"lower_threshold_critical", "threshold below the normal range, but not fatal,"},
+		{"upper_threshold_critical", "threshold above the normal range, but not fatal,"},
+		{"lower_threshold_fatal", "threshold below the normal range, and is fatal,"},
+		{"upper_threshold_fatal", "threshold above the normal range, and is fatal,"},
+		{"min_reading_range", "lowest possible reading"},
+		{"max_reading_range", "highest possible reading"},
+	} {
+		addToMetricMap(metricMap, subsystem, fmt.Sprintf("%s_%s_%s", name, threshold.name, unit), fmt.Sprintf("%s of %s, in %s", threshold.help, sensor, unit), variableLabels)
+	}
+	addToMetricMap(metricMap, subsystem, fmt.Sprintf("%s_threshold_band", name), fmt.Sprintf("threshold band the reading of %s is in,%s", sensor, CommonThresholdBandHelp), variableLabels)
+}
+
+// parseSensorThresholds sends the thresholds the sensor reports and the threshold band of its reading, metricKey and
+// unit are the ones the metrics were added with by addThresholdsToMetricMap. There is no band without a reading or
+// when the sensor is absent.
+func parseSensorThresholds(ch chan<- prometheus.Metric, metrics map[string]Metric, metricKey, unit string, reading *float64, state gofishcommon.State, thresholds sensorThresholds, labelValues []string) {
+	for _, threshold := range []struct {
+		name  string
+		value *float64
+	}{
+		{"lower_threshold_non_critical", thresholds.LowerNonCritical},
+		{"upper_threshold_non_critical", thresholds.UpperNonCritical},
+		{"lower_threshold_critical", thresholds.LowerCritical},
+		{"upper_threshold_critical", thresholds.UpperCritical},
+		{"lower_threshold_fatal", thresholds.LowerFatal},
+		{"upper_threshold_fatal", thresholds.UpperFatal},
+		{"min_reading_range", thresholds.MinReadingRange},
+		{"max_reading_range", thresholds.MaxReadingRange},
+	} {
+		if threshold.value == nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(metrics[fmt.Sprintf("%s_%s_%s", metricKey, threshold.name, unit)].desc, prometheus.GaugeValue, *threshold.value, labelValues...)
+	}
+	if reading == nil || state == gofishcommon.AbsentState {
+		return
+	}
+	if band, ok := thresholds.band(*reading); ok {
+		ch <- prometheus.MustNewConstMetric(metrics[fmt.Sprintf("%s_threshold_band", metricKey)].desc, prometheus.GaugeValue, band, labelValues...)
+	}
+}
+
+func parseLogService(ch chan<- prometheus.Metric, metrics map[string]Metric, subsystem, collectorID string, logService *redfish.LogService, options LogEntryOptions, logs *TargetLogs) (err error) {
 	logServiceName := logService.Name
 	logServiceID := logService.ID
 	logServiceEnabled := fmt.Sprint(logService.ServiceEnabled)
@@ -51,20 +153,120 @@ func parseLogService(ch chan<- prometheus.Metric, metrics map[string]Metric, sub
 		ch <- prometheus.MustNewConstMetric(metrics[fmt.Sprintf("%s_%s", subsystem, "log_service_health_state")].desc, prometheus.GaugeValue, logServiceHealthStateValue, logServiceLabelValues...)
 	}
 
+	if options.Incremental && logs != nil && logs.cursors != nil {
+		return parseNewLogEntries(ch, metrics, subsystem, collectorID, logService, options, logs)
+	}
+
 	logEntries, err := logService.Entries()
 	if err != nil {
 		return
 	}
-	wg2 := &sync.WaitGroup{}
-	wg2.Add(len(logEntries))
+
+	// count the entries by severity instead of exporting a series per entry
+	counts := make(map[string]int)
+	newest := make(map[string]time.Time)
 	for _, logEntry := range logEntries {
-		go parseLogEntry(ch, metrics[fmt.Sprintf("%s_%s", subsystem, "log_entry_severity_state")].desc, collectorID, logServiceName, logServiceID, logEntry, wg2)
+		severity := logs.severity(logEntry)
+		counts[severity]++
+		if created, ok := parseLogEntryCreated(logEntry); ok && created.After(newest[severity]) {
+			newest[severity] = created
+		}
+	}
+	for severity, count := range counts {
+		ch <- prometheus.MustNewConstMetric(metrics[fmt.Sprintf("%s_%s", subsystem, "log_entries")].desc, prometheus.GaugeValue, float64(count), collectorID, logServiceName, logServiceID, severity)
+	}
+	for severity, created := range newest {
+		ch <- prometheus.MustNewConstMetric(metrics[fmt.Sprintf("%s_%s", subsystem, "log_entry_newest_timestamp_seconds")].desc, prometheus.GaugeValue, float64(created.Unix()), collectorID, logServiceName, logServiceID, severity)
+	}
+
+	if options.Detail {
+		for _, logEntry := range detailLogEntries(logEntries, options) {
+			parseLogEntry(ch, metrics[fmt.Sprintf("%s_%s", subsystem, "log_entry_severity_state")].desc, collectorID, logServiceName, logServiceID, logEntry, logs)
+		}
 	}
 	return
 }
 
-func parseLogEntry(ch chan<- prometheus.Metric, desc *prometheus.Desc, collectorID, logServiceName, logServiceID string, logEntry *redfish.LogEntry, wg *sync.WaitGroup) {
-	defer wg.Done()
+// parseNewLogEntries only fetches the entries added to the log service since the previous scrape of the target, and
+// exports the number of entries seen by severity and message ID.
+func parseNewLogEntries(ch chan<- prometheus.Metric, metrics map[string]Metric, subsystem, collectorID string, logService *redfish.LogService, options LogEntryOptions, logs *TargetLogs) error {
+	cursor, newEntries, err := logs.cursors.fetchNewEntries(logService, logs.severity)
+	if cursor == nil {
+		return err
+	}
+	defer cursor.done()
+	// the entries got before an error are known to the cursor from now on, they are processed like any other
+	// the entries of the first fetch were logged before the log was followed, only the later ones are forwarded
+	if !cursor.initial {
+		logs.forward(subsystem, collectorID, logService, newEntries)
+	}
+
+	logServiceName := logService.Name
+	logServiceID := logService.ID
+	for severity, messageIDs := range cursor.Totals {
+		for messageID, total := range messageIDs {
+			logs.resolve(messageID)
+			ch <- prometheus.MustNewConstMetric(metrics[fmt.Sprintf("%s_%s", subsystem, "log_entries_total")].desc, prometheus.CounterValue, total, collectorID, logServiceName, logServiceID, severity, messageID)
+		}
+	}
+	for severity, created := range cursor.Newest {
+		ch <- prometheus.MustNewConstMetric(metrics[fmt.Sprintf("%s_%s", subsystem, "log_entry_newest_timestamp_seconds")].desc, prometheus.GaugeValue, float64(created.Unix()), collectorID, logServiceName, logServiceID, severity)
+	}
+
+	if options.Detail {
+		// the entries fetched by earlier scrapes are kept for the detail series, a bounded number of them
+		retainOptions := options
+		if retainOptions.DetailLimit == 0 && retainOptions.DetailMaxAge == 0 {
+			retainOptions.DetailLimit = defaultRetainedLogEntries
+		}
+		cursor.retained = detailLogEntries(append(cursor.retained, newEntries...), retainOptions)
+		for _, logEntry := range cursor.retained {
+			parseLogEntry(ch, metrics[fmt.Sprintf("%s_%s", subsystem, "log_entry_severity_state")].desc, collectorID, logServiceName, logServiceID, logEntry, logs)
+		}
+	}
+	return err
+}
+
+func parseLogEntryCreated(logEntry *redfish.LogEntry) (time.Time, bool) {
+	created, err := time.Parse(time.RFC3339, logEntry.Created)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return created, true
+}
+
+// detailLogEntries returns the entries to export a series for, the newest first: the entries created within
+// DetailMaxAge, at most DetailLimit of them. Entries without a valid creation time count as the oldest.
+func detailLogEntries(logEntries []*redfish.LogEntry, options LogEntryOptions) []*redfish.LogEntry {
+	if options.DetailLimit == 0 && options.DetailMaxAge == 0 {
+		return logEntries
+	}
+	type datedEntry struct {
+		entry   *redfish.LogEntry
+		created time.Time
+	}
+	dated := make([]datedEntry, 0, len(logEntries))
+	for _, logEntry := range logEntries {
+		created, ok := parseLogEntryCreated(logEntry)
+		if options.DetailMaxAge > 0 && (!ok || time.Since(created) > options.DetailMaxAge) {
+			continue
+		}
+		dated = append(dated, datedEntry{entry: logEntry, created: created})
+	}
+	sort.SliceStable(dated, func(i, j int) bool {
+		return dated[i].created.After(dated[j].created)
+	})
+	if options.DetailLimit > 0 && len(dated) > options.DetailLimit {
+		dated = dated[:options.DetailLimit]
+	}
+	selected := make([]*redfish.LogEntry, len(dated))
+	for i := range dated {
+		selected[i] = dated[i].entry
+	}
+	return selected
+}
+
+func parseLogEntry(ch chan<- prometheus.Metric, desc *prometheus.Desc, collectorID, logServiceName, logServiceID string, logEntry *redfish.LogEntry, logs *TargetLogs) {
 	logEntryName := logEntry.Name
 	logEntryID := logEntry.ID
 	logEntryCode := string(logEntry.EntryCode)
@@ -73,8 +275,9 @@ func parseLogEntry(ch chan<- prometheus.Metric, desc *prometheus.Desc, collector
 	logEntrySensorNumber := fmt.Sprint(logEntry.SensorNumber)
 	logEntrySensorType := string(logEntry.SensorType)
 	logEntrySeverityState := logEntry.Severity
+	logEntryMessage := logs.message(logEntry)
 
-	logEntryLabelValues := []string{collectorID, logServiceName, logServiceID, logEntryName, logEntryID, logEntryCode, logEntryType, logEntryMessageID, logEntrySensorNumber, logEntrySensorType}
+	logEntryLabelValues := []string{collectorID, logServiceName, logServiceID, logEntryName, logEntryID, logEntryCode, logEntryType, logEntryMessageID, logEntrySensorNumber, logEntrySensorType, logEntryMessage}
 
 	if logEntrySeverityStateValue, ok := parseCommonSeverityState(logEntrySeverityState); ok {
 		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, logEntrySeverityStateValue, logEntryLabelValues...)
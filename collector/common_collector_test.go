@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	gofishcommon "github.com/stmcginnis/gofish/common"
+)
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func TestSensorThresholdsBand(t *testing.T) {
+	temperature := sensorThresholds{
+		LowerNonCritical: float(5),
+		UpperNonCritical: float(70),
+		LowerCritical:    float(0),
+		UpperCritical:    float(85),
+		LowerFatal:       float(-10),
+		UpperFatal:       float(95),
+	}
+	tests := []struct {
+		name       string
+		thresholds sensorThresholds
+		reading    float64
+		wantBand   float64
+		wantOK     bool
+	}{
+		{"normal", temperature, 40, 0, true},
+		{"upper non critical", temperature, 70, 2, true},
+		{"lower non critical", temperature, 3, 1, true},
+		{"upper critical", temperature, 90, 4, true},
+		{"lower critical at a 0 threshold", temperature, 0, 3, true},
+		{"lower fatal", temperature, -20, 5, true},
+		{"upper fatal", temperature, 100, 6, true},
+		{"no thresholds", sensorThresholds{}, 0, 0, false},
+		{"only an upper threshold", sensorThresholds{UpperCritical: float(85)}, 0, 0, true},
+		{"only a reading range", sensorThresholds{MinReadingRange: float(0), MaxReadingRange: float(100)}, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			band, ok := tt.thresholds.band(tt.reading)
+			if band != tt.wantBand || ok != tt.wantOK {
+				t.Errorf("band(%v) = %v, %t, want %v, %t", tt.reading, band, ok, tt.wantBand, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseSensorThresholds(t *testing.T) {
+	thresholds := sensorThresholds{
+		LowerCritical:   float(0),
+		UpperCritical:   float(85),
+		MinReadingRange: float(-40),
+	}
+	tests := []struct {
+		name    string
+		reading *float64
+		state   gofishcommon.State
+		want    map[string]float64
+	}{
+		{"in range", float(40), gofishcommon.EnabledState, map[string]float64{
+			"lower_threshold_critical_celsius": 0,
+			"upper_threshold_critical_celsius": 85,
+			"min_reading_range_celsius":        -40,
+			"threshold_band":                   0,
+		}},
+		{"at a 0 threshold", float(0), gofishcommon.EnabledState, map[string]float64{
+			"lower_threshold_critical_celsius": 0,
+			"upper_threshold_critical_celsius": 85,
+			"min_reading_range_celsius":        -40,
+			"threshold_band":                   3,
+		}},
+		{"without a reading", nil, gofishcommon.EnabledState, map[string]float64{
+			"lower_threshold_critical_celsius": 0,
+			"upper_threshold_critical_celsius": 85,
+			"min_reading_range_celsius":        -40,
+		}},
+		{"absent", float(0), gofishcommon.AbsentState, map[string]float64{
+			"lower_threshold_critical_celsius": 0,
+			"upper_threshold_critical_celsius": 85,
+			"min_reading_range_celsius":        -40,
+		}},
+	}
+	names := make(map[*prometheus.Desc]string)
+	for _, name := range []string{"lower_threshold_critical_celsius", "upper_threshold_critical_celsius", "min_reading_range_celsius", "threshold_band"} {
+		names[chassisMetrics["chassis_temperature_"+name].desc] = name
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := make(chan prometheus.Metric, 16)
+			parseSensorThresholds(ch, chassisMetrics, "chassis_temperature", "celsius", tt.reading, tt.state, thresholds, []string{"temperature", "1", "CPU1 Temp", "0"})
+			close(ch)
+			got := make(map[string]float64)
+			for metric := range ch {
+				name, ok := names[metric.Desc()]
+				if !ok {
+					t.Errorf("unexpected metric %s", metric.Desc())
+					continue
+				}
+				var m dto.Metric
+				metric.Write(&m)
+				got[name] = m.GetGauge().GetValue()
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSensorThresholds() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSensorThresholdsScaled(t *testing.T) {
+	scaled := sensorThresholds{LowerCritical: float(2), UpperCritical: float(0)}.scaled(1000)
+	if scaled.LowerCritical == nil || *scaled.LowerCritical != 2000 || scaled.UpperCritical == nil || *scaled.UpperCritical != 0 || scaled.UpperFatal != nil {
+		t.Errorf("scaled() = %+v, want a lower critical of 2000, an upper critical of 0 and no others", scaled)
+	}
+}
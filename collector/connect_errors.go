@@ -0,0 +1,150 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	gofishcommon "github.com/stmcginnis/gofish/common"
+)
+
+// Reasons of a failed connection, as exported by redfish_connect_error.
+const (
+	connectErrorDNS                = "dns"
+	connectErrorTCPTimeout         = "tcp_timeout"
+	connectErrorTCPRefused         = "tcp_refused"
+	connectErrorTCP                = "tcp"
+	connectErrorTLSHandshake       = "tls_handshake"
+	connectErrorAuth               = "auth"
+	connectErrorHTTPStatus         = "http_status"
+	connectErrorInvalidServiceRoot = "invalid_service_root"
+	connectErrorCircuitOpen        = "circuit_open"
+	connectErrorTimeout            = "timeout"
+	connectErrorOther              = "other"
+)
+
+// serviceRootPath is the path of the redfish service root.
+const serviceRootPath = "/redfish/v1/"
+
+// errCircuitOpen is returned for requests to a target whose circuit breaker is open.
+var errCircuitOpen = errors.New("circuit breaker open")
+
+// connectTrace records the TLS handshake and the service root response of the connection to a target.
+type connectTrace struct {
+	mu                sync.Mutex
+	handshakeStart    time.Time
+	handshakeDuration time.Duration
+	handshakeErr      error
+	handshakeDone     bool
+	rootStatusCode    int
+}
+
+type connectTraceKey struct{}
+
+// withConnectTrace returns a context recording the first TLS handshake and service root response of the requests
+// made with it.
+func withConnectTrace(ctx context.Context) (context.Context, *connectTrace) {
+	trace := &connectTrace{}
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		TLSHandshakeStart: func() {
+			trace.mu.Lock()
+			if trace.handshakeStart.IsZero() {
+				trace.handshakeStart = time.Now()
+			}
+			trace.mu.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			trace.mu.Lock()
+			if !trace.handshakeDone {
+				trace.handshakeDone = true
+				trace.handshakeDuration = time.Since(trace.handshakeStart)
+				trace.handshakeErr = err
+			}
+			trace.mu.Unlock()
+		},
+	})
+	return context.WithValue(ctx, connectTraceKey{}, trace), trace
+}
+
+// handshake returns the duration of the first TLS handshake, if one completed.
+func (t *connectTrace) handshake() (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.handshakeDuration, t.handshakeDone && t.handshakeErr == nil
+}
+
+// rootStatus returns the HTTP status code of the service root, if it answered.
+func (t *connectTrace) rootStatus() (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rootStatusCode, t.rootStatusCode != 0
+}
+
+// traceTransport is a http.RoundTripper recording the service root status code in the connectTrace of the request.
+type traceTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil && strings.TrimSuffix(req.URL.Path, "/")+"/" == serviceRootPath {
+		if trace, ok := req.Context().Value(connectTraceKey{}).(*connectTrace); ok {
+			trace.mu.Lock()
+			if trace.rootStatusCode == 0 {
+				trace.rootStatusCode = resp.StatusCode
+			}
+			trace.mu.Unlock()
+		}
+	}
+	return resp, err
+}
+
+// classifyConnectError returns the reason a connection to a target failed with err.
+func classifyConnectError(err error, trace *connectTrace) string {
+	var (
+		dnsErr       *net.DNSError
+		opErr        *net.OpError
+		redfishErr   *gofishcommon.Error
+		syntaxErr    *json.SyntaxError
+		unmarshalErr *json.UnmarshalTypeError
+	)
+	trace.mu.Lock()
+	handshakeFailed := trace.handshakeDone && trace.handshakeErr != nil
+	trace.mu.Unlock()
+
+	switch {
+	case errors.Is(err, errCircuitOpen):
+		return connectErrorCircuitOpen
+	case errors.As(err, &dnsErr):
+		return connectErrorDNS
+	case handshakeFailed:
+		return connectErrorTLSHandshake
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		if opErr.Timeout() {
+			return connectErrorTCPTimeout
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return connectErrorTCPRefused
+		}
+		return connectErrorTCP
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled):
+		return connectErrorTimeout
+	case errors.As(err, &redfishErr):
+		if redfishErr.HTTPReturnedStatusCode == http.StatusUnauthorized || redfishErr.HTTPReturnedStatusCode == http.StatusForbidden {
+			return connectErrorAuth
+		}
+		return connectErrorHTTPStatus
+	case errors.As(err, &syntaxErr) || errors.As(err, &unmarshalErr):
+		return connectErrorInvalidServiceRoot
+	}
+	return connectErrorOther
+}
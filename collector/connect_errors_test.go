@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	stdlog "log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gofish "github.com/stmcginnis/gofish"
+)
+
+func TestClassifyConnectError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the endpoint of a test is the server URL with the answer as first segment
+		switch strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0] {
+		case "401":
+			http.Error(w, `{"error": {"code": "Base.1.0.NoValidSession"}}`, http.StatusUnauthorized)
+		case "403":
+			http.Error(w, `{"error": {"code": "Base.1.0.InsufficientPrivilege"}}`, http.StatusForbidden)
+		case "500":
+			http.Error(w, `{"error": {"code": "Base.1.0.InternalError"}}`, http.StatusInternalServerError)
+		case "html":
+			fmt.Fprint(w, "<html>not a redfish service</html>")
+		case "type":
+			fmt.Fprint(w, `{"Id": 1}`)
+		case "slow":
+			<-r.Context().Done()
+		}
+	}))
+	defer server.Close()
+	tlsServer := httptest.NewUnstartedServer(http.NotFoundHandler())
+	// the failed handshake is expected
+	tlsServer.Config.ErrorLog = stdlog.New(ioutil.Discard, "", 0)
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() = %s", err)
+	}
+	refused := listener.Addr().String()
+	listener.Close()
+
+	tests := []struct {
+		name     string
+		endpoint string
+		// dialTimeout and timeout bound connecting and the whole connection when set
+		dialTimeout time.Duration
+		timeout     time.Duration
+		err         error
+		want        string
+	}{
+		{name: "circuit open", err: fmt.Errorf("target bmc: %w", errCircuitOpen), want: connectErrorCircuitOpen},
+		{name: "dns", endpoint: "http://bmc.invalid", want: connectErrorDNS},
+		{name: "tcp timeout", endpoint: server.URL, dialTimeout: time.Nanosecond, want: connectErrorTCPTimeout},
+		{name: "tcp refused", endpoint: "http://" + refused, want: connectErrorTCPRefused},
+		{name: "tls handshake", endpoint: tlsServer.URL, want: connectErrorTLSHandshake},
+		{name: "auth 401", endpoint: server.URL + "/401", want: connectErrorAuth},
+		{name: "auth 403", endpoint: server.URL + "/403", want: connectErrorAuth},
+		{name: "http status", endpoint: server.URL + "/500", want: connectErrorHTTPStatus},
+		{name: "json syntax", endpoint: server.URL + "/html", want: connectErrorInvalidServiceRoot},
+		{name: "json type", endpoint: server.URL + "/type", want: connectErrorInvalidServiceRoot},
+		{name: "timeout", endpoint: server.URL + "/slow", timeout: 50 * time.Millisecond, want: connectErrorTimeout},
+		{name: "other", err: fmt.Errorf("unexpected"), want: connectErrorOther},
+	}
+	for _, test := range tests {
+		ctx, trace := withConnectTrace(context.Background())
+		err := test.err
+		if test.endpoint != "" {
+			if test.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, test.timeout)
+				defer cancel()
+			}
+			// the endpoint is not trusted, the certificate of the TLS server fails the handshake
+			transport := &http.Transport{DialContext: (&net.Dialer{Timeout: test.dialTimeout}).DialContext}
+			_, err = gofish.ConnectContext(ctx, gofish.ClientConfig{Endpoint: test.endpoint, HTTPClient: &http.Client{Transport: transport}})
+			if err == nil {
+				t.Errorf("%s: connecting did not fail", test.name)
+				continue
+			}
+		}
+		if got := classifyConnectError(err, trace); got != test.want {
+			t.Errorf("%s: classifyConnectError(%v) = %s, want %s", test.name, err, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"sync"
+	"time"
+)
+
+// joulesPerKWh converts the kWh readings of the BMCs to joules.
+const joulesPerKWh = 3.6e6
+
+// EnergyEstimate integrates the power consumption of the chassis of a polled target over its polls, for the chassis
+// without an energy counter of their own. Only readings of consecutive polls are integrated, the energy consumed
+// while a poll failed or the chassis reported no power is not estimated.
+type EnergyEstimate struct {
+	mu      sync.Mutex
+	poll    int
+	chassis map[string]*chassisEnergy
+}
+
+// chassisEnergy is the estimated energy of a chassis and its latest power reading.
+type chassisEnergy struct {
+	joules float64
+	watts  float64
+	time   time.Time
+	poll   int
+}
+
+// NewEnergyEstimate returns an EnergyEstimate starting at zero joules for every chassis.
+func NewEnergyEstimate() *EnergyEstimate {
+	return &EnergyEstimate{chassis: make(map[string]*chassisEnergy)}
+}
+
+// begin starts a poll of the target.
+func (e *EnergyEstimate) begin() {
+	e.mu.Lock()
+	e.poll++
+	e.mu.Unlock()
+}
+
+// add integrates the power reading of the chassis taken at the time of the current poll with the reading of the
+// previous poll, and returns the energy the chassis consumed since it was first polled.
+func (e *EnergyEstimate) add(chassisID string, watts float64, at time.Time) float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	energy, ok := e.chassis[chassisID]
+	if !ok {
+		energy = &chassisEnergy{}
+		e.chassis[chassisID] = energy
+	} else if energy.poll == e.poll-1 && at.After(energy.time) {
+		// trapezoidal rule
+		energy.joules += (energy.watts + watts) / 2 * at.Sub(energy.time).Seconds()
+	}
+	energy.watts = watts
+	energy.time = at
+	energy.poll = e.poll
+	return energy.joules
+}
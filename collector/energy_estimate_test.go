@@ -0,0 +1,52 @@
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnergyEstimate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	estimate := NewEnergyEstimate()
+	poll := func(chassisID string, watts float64, seconds int) float64 {
+		estimate.begin()
+		return estimate.add(chassisID, watts, start.Add(time.Duration(seconds)*time.Second))
+	}
+
+	if joules := poll("1", 100, 0); joules != 0 {
+		t.Errorf("energy after the first poll = %v, want 0", joules)
+	}
+	// trapezoidal rule: (100 W + 300 W) / 2 * 10 s
+	if joules := poll("1", 300, 10); joules != 2000 {
+		t.Errorf("energy after the second poll = %v, want 2000", joules)
+	}
+
+	// a failed poll reports no power, the time until the next poll is not integrated
+	estimate.begin()
+	if joules := poll("1", 300, 30); joules != 2000 {
+		t.Errorf("energy after a skipped poll = %v, want 2000", joules)
+	}
+	// the polls after it are integrated again
+	if joules := poll("1", 100, 40); joules != 4000 {
+		t.Errorf("energy after the poll following a skipped poll = %v, want 4000", joules)
+	}
+
+	// readings not taken after the previous one are not integrated
+	if joules := poll("1", 100, 40); joules != 4000 {
+		t.Errorf("energy after a reading at the same time = %v, want 4000", joules)
+	}
+	if joules := poll("1", 100, 35); joules != 4000 {
+		t.Errorf("energy after a reading back in time = %v, want 4000", joules)
+	}
+	// the next reading is integrated from the reading back in time
+	if joules := poll("1", 100, 45); joules != 5000 {
+		t.Errorf("energy after the clock went back = %v, want 5000", joules)
+	}
+
+	// every chassis is integrated on its own, starting at its first poll
+	estimate.begin()
+	estimate.add("1", 100, start.Add(55*time.Second))
+	if joules := estimate.add("2", 500, start.Add(55*time.Second)); joules != 0 {
+		t.Errorf("energy of another chassis after its first poll = %v, want 0", joules)
+	}
+}
@@ -0,0 +1,483 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	gofishcommon "github.com/stmcginnis/gofish/common"
+	"github.com/stmcginnis/gofish/redfish"
+)
+
+// logCursorSaveInterval is how often changed cursors are written to the state file.
+const logCursorSaveInterval = 30 * time.Second
+
+// LogCursorStore remembers per target and log service which log entries were already seen, so that a scrape only
+// fetches the entries added since the previous one. The cursors are optionally persisted to a state file so that a
+// restart does not process the whole log again.
+type LogCursorStore struct {
+	mu       sync.Mutex
+	cursors  map[string]*logCursor
+	features map[string]protocolFeatures
+	path     string
+	dirty    bool
+	Log      *log.Entry
+}
+
+// logCursor is the position of the incremental fetch of one log service.
+type logCursor struct {
+	mu sync.Mutex
+	// EntriesURI is the log entry collection of the log service.
+	EntriesURI string `json:"entries_uri"`
+	// Known holds the IDs of the entries seen, only the ones created at LastCreated when the service filters by
+	// creation time.
+	Known map[string]bool `json:"known"`
+	// LastCreated is the creation time of the newest entry, as formatted by the BMC.
+	LastCreated string `json:"last_created,omitempty"`
+	// Count is the number of entries of the collection at the previous fetch, LastID the ID of the last of them.
+	Count  int    `json:"count"`
+	LastID string `json:"last_id,omitempty"`
+	// Seeded is set once the entries the log held when it was first fetched are known.
+	Seeded bool `json:"seeded"`
+	// Totals counts the entries seen by severity and message ID.
+	Totals map[string]map[string]float64 `json:"totals"`
+	// Newest is the creation time of the newest entry by severity.
+	Newest map[string]time.Time `json:"newest"`
+	// retained are the entries exported as detail series, they are not persisted.
+	retained []*redfish.LogEntry
+	// initial is set when the latest fetch was the first one of the log service, its entries were already in the log
+	// before the exporter followed it.
+	initial bool
+}
+
+// protocolFeatures are the query parameters a redfish service supports.
+type protocolFeatures struct {
+	FilterQuery  bool
+	TopSkipQuery bool
+}
+
+// NewLogCursorStore returns a LogCursorStore persisted to the state file at path, loading the cursors it holds. An
+// empty path keeps the cursors in memory only.
+func NewLogCursorStore(path string, logger *log.Entry) (*LogCursorStore, error) {
+	s := &LogCursorStore{
+		cursors:  make(map[string]*logCursor),
+		features: make(map[string]protocolFeatures),
+		path:     path,
+		Log:      logger,
+	}
+	if path == "" {
+		return s, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading log cursor state file: %s", err)
+	}
+	if err := json.Unmarshal(content, &s.cursors); err != nil {
+		return nil, fmt.Errorf("error parsing log cursor state file %s: %s", path, err)
+	}
+	return s, nil
+}
+
+// Run writes the changed cursors to the state file until ctx is done.
+func (s *LogCursorStore) Run(ctx context.Context) {
+	if s.path == "" {
+		return
+	}
+	ticker := time.NewTicker(logCursorSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Save(); err != nil {
+				s.Log.WithError(err).Error("error saving log cursors")
+			}
+		}
+	}
+}
+
+// Save writes the cursors to the state file if they changed since the last save.
+func (s *LogCursorStore) Save() error {
+	if s.path == "" {
+		return nil
+	}
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	s.dirty = false
+	cursors := make(map[string]*logCursor, len(s.cursors))
+	for key, cursor := range s.cursors {
+		cursors[key] = cursor
+	}
+	s.mu.Unlock()
+
+	// the cursors are locked one by one while they are encoded
+	encoded := make(map[string]json.RawMessage, len(cursors))
+	for key, cursor := range cursors {
+		cursor.mu.Lock()
+		content, err := json.Marshal(cursor)
+		cursor.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		encoded[key] = content
+	}
+	content, err := json.Marshal(encoded)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so that a crash never leaves a truncated state file behind
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Target returns the cursors of the log services of host.
+func (s *LogCursorStore) Target(host string) *LogCursors {
+	if s == nil {
+		return nil
+	}
+	return &LogCursors{store: s, host: host}
+}
+
+func (s *LogCursorStore) cursor(key string) *logCursor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cursor, ok := s.cursors[key]
+	if !ok {
+		cursor = &logCursor{}
+		s.cursors[key] = cursor
+	}
+	return cursor
+}
+
+func (s *LogCursorStore) markDirty() {
+	s.mu.Lock()
+	s.dirty = true
+	s.mu.Unlock()
+}
+
+// LogCursors gives access to the cursors of the log services of one target.
+type LogCursors struct {
+	store *LogCursorStore
+	host  string
+}
+
+// fetchNewEntries returns the entries of logService added since the previous call for the same log service of the
+// target, along with the cursor of the log service. The cursor stays locked until the caller calls done, it is nil when
+// the entries could not be listed. When only some of the new entries could be got, they are returned along with the
+// error; they are known to the cursor from then on, so the caller processes them as on success. The calls until the
+// entries the log held when it was first fetched are all known set the initial flag of the cursor.
+func (c *LogCursors) fetchNewEntries(logService *redfish.LogService, severity func(*redfish.LogEntry) string) (*logCursor, []*redfish.LogEntry, error) {
+	cursor := c.store.cursor(c.host + logService.ODataID)
+	cursor.mu.Lock()
+	newEntries, fetchErr, err := c.fetchNewEntriesLocked(cursor, logService, severity)
+	if err != nil {
+		cursor.mu.Unlock()
+		return nil, nil, err
+	}
+	return cursor, newEntries, fetchErr
+}
+
+// fetchNewEntriesLocked is fetchNewEntries with the cursor locked. err is set when the entries could not be listed,
+// the cursor is unchanged then, fetchErr when some of the new entries could not be got.
+func (c *LogCursors) fetchNewEntriesLocked(cursor *logCursor, logService *redfish.LogService, severity func(*redfish.LogEntry) string) (newEntries []*redfish.LogEntry, fetchErr, err error) {
+	client := logService.Client
+	if cursor.EntriesURI == "" {
+		var raw struct {
+			Entries gofishcommon.Link
+		}
+		if err = getJSON(client, logService.ODataID, &raw); err != nil {
+			return
+		}
+		cursor.EntriesURI = string(raw.Entries)
+	}
+	if cursor.EntriesURI == "" {
+		return
+	}
+	features, err := c.features(client)
+	if err != nil {
+		return
+	}
+
+	// the entries known from a first fetch that failed partly were not forwarded either
+	cursor.initial = !cursor.Seeded
+
+	query := url.Values{}
+	switch {
+	case features.FilterQuery && cursor.LastCreated != "":
+		// ge rather than gt, so that entries created in the same second as the newest known one are not missed
+		query.Set("$filter", fmt.Sprintf("Created ge '%s'", cursor.LastCreated))
+	case features.TopSkipQuery && cursor.Count > 0 && cursor.LastID != "":
+		// the page starts with the last known entry, so that it can be checked that the log was only appended to
+		query.Set("$skip", fmt.Sprint(cursor.Count-1))
+	}
+	members, count, err := listLogEntries(client, cursor.EntriesURI, query)
+	if err != nil {
+		return
+	}
+	if query.Get("$skip") != "" && (len(members) == 0 || memberID(members[0]) != cursor.LastID) {
+		// the log was cleared, wrapped or is ordered newest first, the new entries can be anywhere in it
+		query = url.Values{}
+		if members, count, err = listLogEntries(client, cursor.EntriesURI, query); err != nil {
+			return
+		}
+	}
+
+	var links []string
+	seen := make(map[string]bool, len(members))
+	for _, member := range members {
+		if member.entry == nil {
+			if id := memberID(member); cursor.Known[id] {
+				seen[id] = true
+			} else {
+				links = append(links, member.link)
+			}
+			continue
+		}
+		seen[member.entry.ID] = true
+		if !cursor.Known[member.entry.ID] {
+			newEntries = append(newEntries, member.entry)
+		}
+	}
+	if len(links) > 0 {
+		// the entries that could not be fetched stay unknown and are fetched again on the next scrape
+		var fetched []*redfish.LogEntry
+		fetched, fetchErr = fetchLogEntries(client, links)
+		for _, logEntry := range fetched {
+			seen[path.Base(logEntry.ODataID)] = true
+		}
+		newEntries = append(newEntries, fetched...)
+	}
+
+	switch {
+	case query.Get("$skip") != "":
+		// the skipped entries are not listed, keep them
+		if cursor.Known == nil {
+			cursor.Known = make(map[string]bool)
+		}
+		for id := range seen {
+			cursor.Known[id] = true
+		}
+	default:
+		// a full listing drops the entries that are gone, a filtered one only needs the entries it lists again
+		cursor.Known = seen
+	}
+	if query.Get("$filter") == "" && fetchErr == nil {
+		cursor.Count = count
+		cursor.LastID = ""
+		if len(members) > 0 {
+			cursor.LastID = memberID(members[len(members)-1])
+		}
+	}
+	if fetchErr == nil {
+		cursor.Seeded = true
+	}
+	if query.Get("$filter") == "" {
+		cursor.pruneRetained()
+	}
+	cursor.count(newEntries, severity)
+	c.store.markDirty()
+	return
+}
+
+// count adds the new entries to the totals and moves LastCreated past them.
+func (cursor *logCursor) count(newEntries []*redfish.LogEntry, severity func(*redfish.LogEntry) string) {
+	if cursor.Totals == nil {
+		cursor.Totals = make(map[string]map[string]float64)
+	}
+	if cursor.Newest == nil {
+		cursor.Newest = make(map[string]time.Time)
+	}
+	lastCreated, _ := time.Parse(time.RFC3339, cursor.LastCreated)
+	for _, logEntry := range newEntries {
+		entrySeverity := severity(logEntry)
+		if cursor.Totals[entrySeverity] == nil {
+			cursor.Totals[entrySeverity] = make(map[string]float64)
+		}
+		cursor.Totals[entrySeverity][logEntry.MessageID]++
+		if created, ok := parseLogEntryCreated(logEntry); ok {
+			if created.After(cursor.Newest[entrySeverity]) {
+				cursor.Newest[entrySeverity] = created
+			}
+			if created.After(lastCreated) {
+				lastCreated = created
+				cursor.LastCreated = logEntry.Created
+			}
+		}
+	}
+}
+
+// pruneRetained drops the retained entries that are no longer in the log, e.g. after it was cleared. Known must hold
+// all entries of the log, which a filtered listing does not tell.
+func (cursor *logCursor) pruneRetained() {
+	retained := cursor.retained[:0]
+	for _, logEntry := range cursor.retained {
+		if cursor.Known[logEntry.ID] || cursor.Known[path.Base(logEntry.ODataID)] {
+			retained = append(retained, logEntry)
+		}
+	}
+	cursor.retained = retained
+}
+
+// done releases the cursor returned by fetchNewEntries.
+func (cursor *logCursor) done() {
+	cursor.mu.Unlock()
+}
+
+// features returns the protocol features of the service of the target, they are only read once.
+func (c *LogCursors) features(client gofishcommon.Client) (protocolFeatures, error) {
+	c.store.mu.Lock()
+	features, ok := c.store.features[c.host]
+	c.store.mu.Unlock()
+	if ok {
+		return features, nil
+	}
+	var root struct {
+		ProtocolFeaturesSupported protocolFeatures
+	}
+	if err := getJSON(client, serviceRootPath, &root); err != nil {
+		return protocolFeatures{}, err
+	}
+	c.store.mu.Lock()
+	c.store.features[c.host] = root.ProtocolFeaturesSupported
+	c.store.mu.Unlock()
+	return root.ProtocolFeaturesSupported, nil
+}
+
+// logEntryMember is a member of a log entry collection, either only its link or the whole entry when the service
+// expands the members.
+type logEntryMember struct {
+	link  string
+	entry *redfish.LogEntry
+}
+
+// memberID returns the ID of the log entry, the last segment of its link when the member is not expanded.
+func memberID(member logEntryMember) string {
+	if member.entry != nil {
+		return member.entry.ID
+	}
+	return path.Base(member.link)
+}
+
+// listLogEntries lists the members of the log entry collection at uri with the query, following the pages of the
+// collection, and returns the member count the service reports for the first page.
+func listLogEntries(client gofishcommon.Client, uri string, query url.Values) ([]logEntryMember, int, error) {
+	if len(query) > 0 {
+		uri = uri + "?" + query.Encode()
+	}
+	var members []logEntryMember
+	count := -1
+	for uri != "" {
+		var page struct {
+			Members  []json.RawMessage
+			Count    *int   `json:"Members@odata.count"`
+			NextLink string `json:"Members@odata.nextLink"`
+		}
+		if err := getJSON(client, uri, &page); err != nil {
+			return nil, 0, err
+		}
+		if count < 0 && page.Count != nil {
+			count = *page.Count
+		}
+		for _, raw := range page.Members {
+			var member struct {
+				ODataID string `json:"@odata.id"`
+				ID      string `json:"Id"`
+			}
+			if err := json.Unmarshal(raw, &member); err != nil {
+				return nil, 0, err
+			}
+			if member.ID == "" {
+				members = append(members, logEntryMember{link: member.ODataID})
+				continue
+			}
+			var entry redfish.LogEntry
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return nil, 0, err
+			}
+			members = append(members, logEntryMember{link: member.ODataID, entry: &entry})
+		}
+		uri = page.NextLink
+	}
+	if count < 0 {
+		count = len(members)
+	}
+	return members, count, nil
+}
+
+// fetchLogEntries gets the log entries at links, three at a time like gofish does.
+func fetchLogEntries(client gofishcommon.Client, links []string) ([]*redfish.LogEntry, error) {
+	var mu sync.Mutex
+	var entries []*redfish.LogEntry
+	collectionError := gofishcommon.NewCollectionError()
+	gofishcommon.CollectCollection(func(link string) {
+		entry, err := redfish.GetLogEntry(client, link)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			collectionError.Failures[link] = err
+			return
+		}
+		entries = append(entries, entry)
+	}, client, links)
+	if !collectionError.Empty() {
+		return entries, collectionError
+	}
+	return entries, nil
+}
+
+func getJSON(client gofishcommon.Client, uri string, v interface{}) error {
+	resp, err := client.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// getJSONInto decodes the resource at uri into every one of vs, e.g. into a gofish type and a type holding the
+// properties gofish decodes as 0 when they are null.
+func getJSONInto(client gofishcommon.Client, uri string, vs ...interface{}) error {
+	resp, err := client.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	for _, v := range vs {
+		if err := json.Unmarshal(body, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
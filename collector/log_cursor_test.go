@@ -0,0 +1,411 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	gofish "github.com/stmcginnis/gofish"
+	"github.com/stmcginnis/gofish/redfish"
+)
+
+const testLogServicePath = "/redfish/v1/Managers/1/LogServices/Log"
+
+// fakeLog is a log service whose entries are listed in the order of entries, supporting $skip and $filter on the
+// creation time when enabled. With links set the members are not expanded, getting the entries in failing fails.
+type fakeLog struct {
+	mu      sync.Mutex
+	entries []string
+	filter  bool
+	skip    bool
+	links   bool
+	failing map[string]bool
+	queries []string
+}
+
+// entry returns the log entry with the ID.
+func (l *fakeLog) entry(id string) map[string]string {
+	return map[string]string{
+		"@odata.id": fmt.Sprintf("%s/Entries/%s", testLogServicePath, id),
+		"Id":        id,
+		"Created":   l.created(id),
+		"Severity":  "OK",
+		"MessageId": "Base.1.0.Success",
+	}
+}
+
+func (l *fakeLog) fail(ids ...string) {
+	l.mu.Lock()
+	l.failing = make(map[string]bool)
+	for _, id := range ids {
+		l.failing[id] = true
+	}
+	l.mu.Unlock()
+}
+
+// created returns the creation time of the entry, the entries are created a second apart in the order of their IDs.
+func (l *fakeLog) created(id string) string {
+	n, _ := strconv.Atoi(strings.TrimPrefix(id, "e"))
+	return time.Date(2024, 1, 1, 0, 0, n, 0, time.UTC).Format(time.RFC3339)
+}
+
+func (l *fakeLog) set(ids ...string) {
+	l.mu.Lock()
+	l.entries = ids
+	l.mu.Unlock()
+}
+
+func (l *fakeLog) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch r.URL.Path {
+	case "/redfish/v1/":
+		fmt.Fprintf(w, `{"@odata.id": "/redfish/v1/", "ProtocolFeaturesSupported": {"FilterQuery": %t, "TopSkipQuery": %t}}`, l.filter, l.skip)
+	case testLogServicePath:
+		fmt.Fprintf(w, `{"@odata.id": %q, "Id": "Log", "Name": "Log", "Entries": {"@odata.id": "%s/Entries"}}`, testLogServicePath, testLogServicePath)
+	case testLogServicePath + "/Entries":
+		l.queries = append(l.queries, r.URL.RawQuery)
+		entries := l.entries
+		if filter := r.URL.Query().Get("$filter"); filter != "" {
+			since := strings.Trim(strings.TrimPrefix(filter, "Created ge "), "'")
+			entries = nil
+			for _, id := range l.entries {
+				if l.created(id) >= since {
+					entries = append(entries, id)
+				}
+			}
+		}
+		if skip, err := strconv.Atoi(r.URL.Query().Get("$skip")); err == nil {
+			if skip > len(entries) {
+				skip = len(entries)
+			}
+			entries = entries[skip:]
+		}
+		members := make([]map[string]string, 0, len(entries))
+		for _, id := range entries {
+			if l.links {
+				members = append(members, map[string]string{"@odata.id": fmt.Sprintf("%s/Entries/%s", testLogServicePath, id)})
+				continue
+			}
+			members = append(members, l.entry(id))
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Members":             members,
+			"Members@odata.count": len(l.entries),
+		})
+	default:
+		id := path.Base(r.URL.Path)
+		switch {
+		case !strings.HasPrefix(r.URL.Path, testLogServicePath+"/Entries/"):
+			http.NotFound(w, r)
+		case l.failing[id]:
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			json.NewEncoder(w).Encode(l.entry(id))
+		}
+	}
+}
+
+// lastQuery returns the query of the latest listing of the entries.
+func (l *fakeLog) lastQuery() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.queries[len(l.queries)-1]
+}
+
+func newTestLogService(t *testing.T, server *httptest.Server) *redfish.LogService {
+	t.Helper()
+	client, err := gofish.ConnectContext(context.Background(), gofish.ClientConfig{Endpoint: server.URL, HTTPClient: server.Client()})
+	if err != nil {
+		t.Fatalf("ConnectContext() = %s", err)
+	}
+	logService, err := redfish.GetLogService(client, testLogServicePath)
+	if err != nil {
+		t.Fatalf("GetLogService() = %s", err)
+	}
+	return logService
+}
+
+func entryIDs(entries []*redfish.LogEntry) []string {
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestFetchNewEntries(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter bool
+		skip   bool
+		before []string
+		after  []string
+		want   []string
+		// prefix of the query of the last listing
+		wantQuery string
+	}{
+		{"appended with skip", false, true, []string{"e1", "e2", "e3"}, []string{"e1", "e2", "e3", "e4", "e5"}, []string{"e4", "e5"}, "%24skip=2"},
+		{"nothing new with skip", false, true, []string{"e1", "e2"}, []string{"e1", "e2"}, []string{}, "%24skip=1"},
+		{"wrapped with skip", false, true, []string{"e1", "e2", "e3"}, []string{"e2", "e3", "e4"}, []string{"e4"}, ""},
+		{"newest first with skip", false, true, []string{"e3", "e2", "e1"}, []string{"e5", "e4", "e3", "e2", "e1"}, []string{"e4", "e5"}, ""},
+		{"cleared with skip", false, true, []string{"e1", "e2", "e3"}, []string{"e4"}, []string{"e4"}, ""},
+		{"cleared and refilled with skip", false, true, []string{"e1", "e2"}, []string{"e4", "e5", "e6"}, []string{"e4", "e5", "e6"}, ""},
+		{"appended with filter", true, true, []string{"e1", "e2"}, []string{"e1", "e2", "e3"}, []string{"e3"}, "%24filter="},
+		{"wrapped with filter", true, false, []string{"e1", "e2"}, []string{"e2", "e3"}, []string{"e3"}, "%24filter="},
+		{"without query support", false, false, []string{"e1", "e2"}, []string{"e3", "e2", "e1"}, []string{"e3"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeLog{filter: tt.filter, skip: tt.skip}
+			server := httptest.NewServer(http.HandlerFunc(fake.serveHTTP))
+			defer server.Close()
+			logService := newTestLogService(t, server)
+			store, _ := NewLogCursorStore("", log.WithField("test", t.Name()))
+			cursors := store.Target("bmc")
+			severity := func(entry *redfish.LogEntry) string { return string(entry.Severity) }
+
+			fake.set(tt.before...)
+			cursor, newEntries, err := cursors.fetchNewEntries(logService, severity)
+			if err != nil {
+				t.Fatalf("first fetchNewEntries() = %s", err)
+			}
+			if !cursor.initial {
+				t.Errorf("first fetch is not initial")
+			}
+			if got := entryIDs(newEntries); !reflect.DeepEqual(got, entryIDsSorted(tt.before)) {
+				t.Errorf("first fetchNewEntries() = %v, want %v", got, tt.before)
+			}
+			cursor.done()
+
+			fake.set(tt.after...)
+			cursor, newEntries, err = cursors.fetchNewEntries(logService, severity)
+			if err != nil {
+				t.Fatalf("fetchNewEntries() = %s", err)
+			}
+			defer cursor.done()
+			if cursor.initial {
+				t.Errorf("second fetch is initial")
+			}
+			if got := entryIDs(newEntries); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fetchNewEntries() = %v, want %v", got, tt.want)
+			}
+			if query := fake.lastQuery(); !strings.HasPrefix(query, tt.wantQuery) || (tt.wantQuery == "" && query != "") {
+				t.Errorf("query of the last listing = %q, want %q", query, tt.wantQuery)
+			}
+			total := cursor.Totals["OK"]["Base.1.0.Success"]
+			if want := float64(len(tt.before) + len(tt.want)); total != want {
+				t.Errorf("total = %v, want %v", total, want)
+			}
+		})
+	}
+}
+
+func TestFetchNewEntriesSeededOnce(t *testing.T) {
+	fake := &fakeLog{skip: true}
+	server := httptest.NewServer(http.HandlerFunc(fake.serveHTTP))
+	defer server.Close()
+	logService := newTestLogService(t, server)
+	store, _ := NewLogCursorStore("", log.WithField("test", t.Name()))
+	cursors := store.Target("bmc")
+	severity := func(entry *redfish.LogEntry) string { return string(entry.Severity) }
+
+	// an empty log is seeded as well, the entries added to it later are new
+	cursor, _, err := cursors.fetchNewEntries(logService, severity)
+	if err != nil {
+		t.Fatalf("fetchNewEntries() = %s", err)
+	}
+	cursor.done()
+	fake.set("e1")
+	cursor, newEntries, err := cursors.fetchNewEntries(logService, severity)
+	if err != nil {
+		t.Fatalf("fetchNewEntries() = %s", err)
+	}
+	cursor.done()
+	if cursor.initial || len(newEntries) != 1 {
+		t.Errorf("fetchNewEntries() after seeding an empty log = %v, initial %t, want [e1] not initial", entryIDs(newEntries), cursor.initial)
+	}
+}
+
+func TestFetchNewEntriesPartly(t *testing.T) {
+	fake := &fakeLog{links: true}
+	server := httptest.NewServer(http.HandlerFunc(fake.serveHTTP))
+	defer server.Close()
+	logService := newTestLogService(t, server)
+	store, _ := NewLogCursorStore("", log.WithField("test", t.Name()))
+	cursors := store.Target("bmc")
+	severity := func(entry *redfish.LogEntry) string { return string(entry.Severity) }
+	fetch := func(wantErr bool) (*logCursor, []string) {
+		t.Helper()
+		cursor, newEntries, err := cursors.fetchNewEntries(logService, severity)
+		if cursor == nil || (err != nil) != wantErr {
+			t.Fatalf("fetchNewEntries() = %v, %v, want an error %t", cursor, err, wantErr)
+		}
+		cursor.done()
+		return cursor, entryIDs(newEntries)
+	}
+
+	// the history of a log whose first fetch failed partly is not new on the next fetch either
+	fake.set("e1", "e2")
+	fake.fail("e2")
+	if cursor, ids := fetch(true); !cursor.initial || !reflect.DeepEqual(ids, []string{"e1"}) {
+		t.Errorf("partly failed first fetch = %v, initial %t, want [e1] initial", ids, cursor.initial)
+	}
+	fake.fail()
+	if cursor, ids := fetch(false); !cursor.initial || !reflect.DeepEqual(ids, []string{"e2"}) {
+		t.Errorf("fetch after a partly failed first fetch = %v, initial %t, want [e2] initial", ids, cursor.initial)
+	}
+
+	// the entries got before the error are returned along with it, the others on the next fetch
+	fake.set("e1", "e2", "e3", "e4")
+	fake.fail("e4")
+	if cursor, ids := fetch(true); cursor.initial || !reflect.DeepEqual(ids, []string{"e3"}) {
+		t.Errorf("partly failed fetch = %v, initial %t, want [e3] not initial", ids, cursor.initial)
+	}
+	fake.fail()
+	cursor, ids := fetch(false)
+	if !reflect.DeepEqual(ids, []string{"e4"}) {
+		t.Errorf("fetch after a partly failed fetch = %v, want [e4]", ids)
+	}
+	if total := cursor.Totals["OK"]["Base.1.0.Success"]; total != 4 {
+		t.Errorf("total = %v, want 4", total)
+	}
+}
+
+func entryIDsSorted(ids []string) []string {
+	sorted := append([]string(nil), ids...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// recordingSink is a LogSink remembering the IDs of the entries sent to it.
+type recordingSink struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (s *recordingSink) Send(entries []ForwardedLogEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range entries {
+		s.ids = append(s.ids, entry.EntryID)
+	}
+}
+
+func (s *recordingSink) Close() {}
+
+func (s *recordingSink) sent() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return entryIDsSorted(s.ids)
+}
+
+func TestParseNewLogEntriesForwardsPartlyFetched(t *testing.T) {
+	fake := &fakeLog{links: true}
+	server := httptest.NewServer(http.HandlerFunc(fake.serveHTTP))
+	defer server.Close()
+	logService := newTestLogService(t, server)
+	store, _ := NewLogCursorStore("", log.WithField("test", t.Name()))
+	sink := &recordingSink{}
+	pipeline := &LogPipeline{Cursors: store}
+	pipeline.SetSinks([]LogSink{sink})
+	logs := pipeline.Target("bmc", nil)
+	scrape := func() error {
+		_, err := scrapeNewLogEntries(logService, LogEntryOptions{Incremental: true}, logs)
+		return err
+	}
+
+	fake.set("e1")
+	if err := scrape(); err != nil {
+		t.Fatalf("parseNewLogEntries() = %s", err)
+	}
+	fake.set("e1", "e2", "e3")
+	fake.fail("e3")
+	if err := scrape(); err == nil {
+		t.Errorf("parseNewLogEntries() with an entry failing = nil, want an error")
+	}
+	if sent := sink.sent(); !reflect.DeepEqual(sent, []string{"e2"}) {
+		t.Errorf("entries forwarded after a partly failed fetch = %v, want [e2]", sent)
+	}
+	fake.fail()
+	if err := scrape(); err != nil {
+		t.Fatalf("parseNewLogEntries() = %s", err)
+	}
+	if sent := sink.sent(); !reflect.DeepEqual(sent, []string{"e2", "e3"}) {
+		t.Errorf("entries forwarded = %v, want [e2 e3]", sent)
+	}
+}
+
+// scrapeNewLogEntries runs parseNewLogEntries for the log service of a chassis and returns the IDs of the entries
+// exported as detail series.
+func scrapeNewLogEntries(logService *redfish.LogService, options LogEntryOptions, logs *TargetLogs) ([]string, error) {
+	ch := make(chan prometheus.Metric)
+	var details []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for metric := range ch {
+			if metric.Desc() != chassisMetrics["chassis_log_entry_severity_state"].desc {
+				continue
+			}
+			var m dto.Metric
+			metric.Write(&m)
+			for _, label := range m.Label {
+				if label.GetName() == "log_entry_id" {
+					details = append(details, label.GetValue())
+				}
+			}
+		}
+	}()
+	err := parseNewLogEntries(ch, chassisMetrics, ChassisSubsystem, "1", logService, options, logs)
+	close(ch)
+	<-done
+	return entryIDsSorted(details), err
+}
+
+func TestRetainedLogEntries(t *testing.T) {
+	fake := &fakeLog{skip: true}
+	server := httptest.NewServer(http.HandlerFunc(fake.serveHTTP))
+	defer server.Close()
+	logService := newTestLogService(t, server)
+	store, _ := NewLogCursorStore("", log.WithField("test", t.Name()))
+	logs := (&LogPipeline{Cursors: store}).Target("bmc", nil)
+	options := LogEntryOptions{Detail: true, Incremental: true}
+
+	// without a limit the newest entries are retained
+	var ids []string
+	for i := 1; i <= defaultRetainedLogEntries+10; i++ {
+		ids = append(ids, fmt.Sprintf("e%d", i))
+	}
+	fake.set(ids...)
+	details, err := scrapeNewLogEntries(logService, options, logs)
+	if err != nil {
+		t.Fatalf("parseNewLogEntries() = %s", err)
+	}
+	if len(details) != defaultRetainedLogEntries {
+		t.Errorf("detail series = %d, want %d", len(details), defaultRetainedLogEntries)
+	}
+
+	// the entries of a cleared log are dropped
+	fake.set("e200")
+	if details, err = scrapeNewLogEntries(logService, options, logs); err != nil {
+		t.Fatalf("parseNewLogEntries() = %s", err)
+	}
+	if !reflect.DeepEqual(details, []string{"e200"}) {
+		t.Errorf("detail series after the log was cleared = %v, want [e200]", details)
+	}
+}
@@ -0,0 +1,169 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	gofish "github.com/stmcginnis/gofish"
+	"github.com/stmcginnis/gofish/redfish"
+)
+
+var logMessageInfoDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "log_message_info"),
+	"Message, severity and resolution of the message IDs of the log entries, as defined by their message registry.",
+	[]string{"message_id", "severity", "message", "resolution"}, nil,
+)
+
+// LogPipeline holds what the scrapes share to process the entries of the log services: the cursors of the
+// incremental fetches, the message registries resolving the message IDs and the sinks the new entries are forwarded
+// to.
+type LogPipeline struct {
+	Cursors    *LogCursorStore
+	Registries *MessageRegistries
+
+	mu    sync.RWMutex
+	sinks []LogSink
+}
+
+// SetSinks replaces the sinks the new log entries are forwarded to. Once it returns no entries are sent to the
+// previous sinks anymore, also by scrapes still running, so the caller can close the ones it no longer uses.
+func (p *LogPipeline) SetSinks(sinks []LogSink) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sinks = sinks
+}
+
+// send sends the entries to the current sinks.
+func (p *LogPipeline) send(entries []ForwardedLogEntry) {
+	// the lock is held while sending, so that SetSinks waits until the previous sinks are no longer sent to
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, sink := range p.sinks {
+		sink.Send(entries)
+	}
+}
+
+// hasSinks returns whether there are sinks to forward the entries to.
+func (p *LogPipeline) hasSinks() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.sinks) > 0
+}
+
+// TargetLogs processes the log entries of one scrape of a target.
+type TargetLogs struct {
+	host       string
+	service    *gofish.Service
+	cursors    *LogCursors
+	registries *MessageRegistries
+	pipeline   *LogPipeline
+
+	mu       sync.Mutex
+	messages map[string]*resolvedMessage
+}
+
+// Target returns the TargetLogs of a scrape of host, service is the service root of the target.
+func (p *LogPipeline) Target(host string, service *gofish.Service) *TargetLogs {
+	if p == nil {
+		return nil
+	}
+	return &TargetLogs{
+		host:       host,
+		service:    service,
+		cursors:    p.Cursors.Target(host),
+		registries: p.Registries,
+		pipeline:   p,
+		messages:   make(map[string]*resolvedMessage),
+	}
+}
+
+// resolve returns the registry message of the message ID, the placeholders of the message are not substituted.
+func (t *TargetLogs) resolve(messageID string) (resolvedMessage, bool) {
+	if t == nil || t.registries == nil || messageID == "" {
+		return resolvedMessage{}, false
+	}
+	t.mu.Lock()
+	message, ok := t.messages[messageID]
+	t.mu.Unlock()
+	if !ok {
+		if resolved, found := t.registries.resolve(t.host, t.service, messageID); found {
+			message = &resolved
+		}
+		// unknown message IDs are remembered as well, so that they are only looked up once per scrape
+		t.mu.Lock()
+		t.messages[messageID] = message
+		t.mu.Unlock()
+	}
+	if message == nil {
+		return resolvedMessage{}, false
+	}
+	return *message, true
+}
+
+// message returns the text of the log entry, its registry message with the arguments of the entry substituted, or
+// the message of the entry itself when the message ID can not be resolved.
+func (t *TargetLogs) message(logEntry *redfish.LogEntry) string {
+	if resolved, ok := t.resolve(logEntry.MessageID); ok {
+		return substituteMessageArgs(resolved.Message, logEntry.MessageArgs)
+	}
+	return logEntry.Message
+}
+
+// severity returns the severity label of a log entry: its own severity, the severity of its registry message, or
+// Unknown.
+func (t *TargetLogs) severity(logEntry *redfish.LogEntry) string {
+	if logEntry.Severity != "" {
+		return string(logEntry.Severity)
+	}
+	if resolved, ok := t.resolve(logEntry.MessageID); ok && resolved.Severity != "" {
+		return resolved.Severity
+	}
+	return "Unknown"
+}
+
+// forward sends the new entries of a log service of the resource with the ID collectorID to the sinks, the ones of the
+// configuration loaded at the time.
+func (t *TargetLogs) forward(subsystem, collectorID string, logService *redfish.LogService, newEntries []*redfish.LogEntry) {
+	if t == nil || len(newEntries) == 0 || !t.pipeline.hasSinks() {
+		return
+	}
+	fetched := time.Now()
+	entries := make([]ForwardedLogEntry, 0, len(newEntries))
+	for _, logEntry := range newEntries {
+		created, ok := parseLogEntryCreated(logEntry)
+		if !ok {
+			created = fetched
+		}
+		resolved, _ := t.resolve(logEntry.MessageID)
+		entries = append(entries, ForwardedLogEntry{
+			Target:       t.host,
+			Subsystem:    subsystem,
+			ResourceID:   collectorID,
+			LogService:   logService.Name,
+			LogServiceID: logService.ID,
+			EntryID:      logEntry.ID,
+			Severity:     t.severity(logEntry),
+			MessageID:    logEntry.MessageID,
+			Message:      t.message(logEntry),
+			Resolution:   resolved.Resolution,
+			Created:      created,
+		})
+	}
+	t.pipeline.send(entries)
+}
+
+// collect sends the registry messages of the message IDs resolved during the scrape.
+func (t *TargetLogs) collect(ch chan<- prometheus.Metric) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for messageID, message := range t.messages {
+		if message == nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(logMessageInfoDesc, prometheus.GaugeValue, 1, messageID, message.Severity, message.Message, message.Resolution)
+	}
+}
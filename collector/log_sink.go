@@ -0,0 +1,242 @@
+package collector
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultSinkBatchSize = 500
+	defaultSinkBatchWait = 5 * time.Second
+	defaultSinkTimeout   = 10 * time.Second
+	// sinkQueueSize bounds the entries waiting to be forwarded, further entries are dropped.
+	sinkQueueSize = 10000
+)
+
+// Results of the forwarded log entries, as exported by redfish_exporter_log_sink_entries_total.
+const (
+	sinkResultSent    = "sent"
+	sinkResultFailed  = "failed"
+	sinkResultDropped = "dropped"
+)
+
+var logSinkEntries = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: exporter,
+		Name:      "log_sink_entries_total",
+		Help:      "Log entries forwarded to a log sink, by result: sent, failed after the retries, or dropped because the queue was full or the sink was closed.",
+	},
+	[]string{"sink", "result"},
+)
+
+func init() {
+	prometheus.MustRegister(logSinkEntries)
+}
+
+// LogSink forwards the new log entries of the targets to an external log store.
+type LogSink interface {
+	// Send queues the entries for forwarding, it does not block the scrape.
+	Send(entries []ForwardedLogEntry)
+	// Close forwards the queued entries and stops the sink.
+	Close()
+}
+
+// ForwardedLogEntry is a new log entry of a log service, along with the target and resource it was read from.
+type ForwardedLogEntry struct {
+	Target string
+	// Subsystem is the kind of resource owning the log service: chassis, system or manager.
+	Subsystem    string
+	ResourceID   string
+	LogService   string
+	LogServiceID string
+	EntryID      string
+	Severity     string
+	MessageID    string
+	// Message is the registry message with the arguments of the entry substituted, Resolution its resolution.
+	Message    string
+	Resolution string
+	// Created is the creation time of the entry, the time it was fetched when the entry has none.
+	Created time.Time
+}
+
+// logfmt formats the entry as a logfmt line holding its message and the fields that are not labels of the sink.
+func (e *ForwardedLogEntry) logfmt() string {
+	var line strings.Builder
+	fields := [][2]string{
+		{"msg", e.Message},
+		{"message_id", e.MessageID},
+		{"entry_id", e.EntryID},
+		{"resolution", e.Resolution},
+	}
+	for _, field := range fields {
+		if field[1] == "" {
+			continue
+		}
+		if line.Len() > 0 {
+			line.WriteByte(' ')
+		}
+		line.WriteString(field[0])
+		line.WriteByte('=')
+		if strings.ContainsAny(field[1], " =\"\\\t\r\n") {
+			line.WriteString(strconv.Quote(field[1]))
+		} else {
+			line.WriteString(field[1])
+		}
+	}
+	return line.String()
+}
+
+// sinkWorker queues the entries sent to a sink and hands them to flush in batches of up to batchSize entries, at the
+// latest batchWait after they were queued. It implements LogSink for the sinks embedding it.
+type sinkWorker struct {
+	name      string
+	batchSize int
+	batchWait time.Duration
+	flush     func(batch []ForwardedLogEntry)
+	queue     chan ForwardedLogEntry
+	stop      chan struct{}
+	done      chan struct{}
+	Log       *log.Entry
+
+	// mu guards closed, Send holds it while queueing so that no entries are queued once Close drains the queue
+	mu     sync.RWMutex
+	closed bool
+}
+
+// newSinkWorker returns a sinkWorker and starts flushing the entries sent to it.
+func newSinkWorker(name string, batchSize int, batchWait time.Duration, flush func(batch []ForwardedLogEntry), logger *log.Entry) *sinkWorker {
+	if batchSize == 0 {
+		batchSize = defaultSinkBatchSize
+	}
+	if batchWait == 0 {
+		batchWait = defaultSinkBatchWait
+	}
+	w := &sinkWorker{
+		name:      name,
+		batchSize: batchSize,
+		batchWait: batchWait,
+		flush:     flush,
+		queue:     make(chan ForwardedLogEntry, sinkQueueSize),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		Log:       logger,
+	}
+	go w.run()
+	return w
+}
+
+// Send implements LogSink, the entries sent after Close are dropped.
+func (w *sinkWorker) Send(entries []ForwardedLogEntry) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		logSinkEntries.WithLabelValues(w.name, sinkResultDropped).Add(float64(len(entries)))
+		w.Log.WithField("dropped", len(entries)).Warn("log sink is closed, dropping log entries")
+		return
+	}
+	dropped := 0
+	for _, entry := range entries {
+		select {
+		case w.queue <- entry:
+		default:
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		logSinkEntries.WithLabelValues(w.name, sinkResultDropped).Add(float64(dropped))
+		w.Log.WithField("dropped", dropped).Warn("log sink queue is full, dropping log entries")
+	}
+}
+
+// Close implements LogSink, it returns once the queued entries are forwarded or have failed.
+func (w *sinkWorker) Close() {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.stop)
+	}
+	w.mu.Unlock()
+	<-w.done
+}
+
+func (w *sinkWorker) run() {
+	defer close(w.done)
+	var batch []ForwardedLogEntry
+	timer := time.NewTimer(w.batchWait)
+	defer timer.Stop()
+	for {
+		select {
+		case entry := <-w.queue:
+			batch = append(batch, entry)
+			if len(batch) >= w.batchSize {
+				w.flush(batch)
+				batch = nil
+			}
+		case <-timer.C:
+			if len(batch) > 0 {
+				w.flush(batch)
+				batch = nil
+			}
+			timer.Reset(w.batchWait)
+		case <-w.stop:
+			// forward what was queued before the sink was closed
+			for len(w.queue) > 0 {
+				batch = append(batch, <-w.queue)
+				if len(batch) >= w.batchSize {
+					w.flush(batch)
+					batch = nil
+				}
+			}
+			if len(batch) > 0 {
+				w.flush(batch)
+			}
+			return
+		}
+	}
+}
+
+// retry calls attempt until it succeeds, fails with an error that is not worth retrying or the retries of the policy
+// are used up, waiting a doubling backoff in between. Retries do not wait once the sink is closing.
+func (w *sinkWorker) retry(policy RetryPolicy, attempt func() (bool, error)) error {
+	backoff := policy.InitialBackoff
+	if backoff == 0 {
+		backoff = defaultInitialBackoff
+	}
+	maxBackoff := policy.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+	for i := 0; ; i++ {
+		retryable, err := attempt()
+		if err == nil || !retryable || i >= policy.MaxRetries {
+			return err
+		}
+		w.Log.WithField("attempt", i+1).WithError(err).Warn("error forwarding log entries, retrying")
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-w.stop:
+			timer.Stop()
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// record counts the entries of a batch that was forwarded or failed.
+func (w *sinkWorker) record(batch []ForwardedLogEntry, err error) {
+	if err != nil {
+		w.Log.WithField("entries", len(batch)).WithError(err).Error("error forwarding log entries")
+		logSinkEntries.WithLabelValues(w.name, sinkResultFailed).Add(float64(len(batch)))
+		return
+	}
+	logSinkEntries.WithLabelValues(w.name, sinkResultSent).Add(float64(len(batch)))
+}
@@ -0,0 +1,37 @@
+package collector
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSinkWorkerClose(t *testing.T) {
+	var mu sync.Mutex
+	var flushed []ForwardedLogEntry
+	flush := func(batch []ForwardedLogEntry) {
+		mu.Lock()
+		flushed = append(flushed, batch...)
+		mu.Unlock()
+	}
+	w := newSinkWorker(t.Name(), 10, time.Hour, flush, log.WithField("test", t.Name()))
+
+	w.Send([]ForwardedLogEntry{{EntryID: "1"}, {EntryID: "2"}})
+	w.Close()
+	if len(flushed) != 2 {
+		t.Errorf("entries flushed on Close() = %d, want 2", len(flushed))
+	}
+
+	// entries sent after Close are counted as dropped rather than queued for nobody
+	w.Send([]ForwardedLogEntry{{EntryID: "3"}})
+	if dropped := testutil.ToFloat64(logSinkEntries.WithLabelValues(t.Name(), sinkResultDropped)); dropped != 1 {
+		t.Errorf("entries dropped after Close() = %v, want 1", dropped)
+	}
+	if len(w.queue) != 0 {
+		t.Errorf("entries queued after Close() = %d, want 0", len(w.queue))
+	}
+	w.Close()
+}
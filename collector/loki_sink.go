@@ -0,0 +1,144 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// LokiSinkOptions configures a LokiSink.
+type LokiSinkOptions struct {
+	// URL is the push endpoint, e.g. http://loki:3100/loki/api/v1/push.
+	URL string
+	// TenantID is sent in the X-Scope-OrgID header when set.
+	TenantID  string
+	Username  string
+	Password  string
+	TLSConfig *tls.Config
+	// BatchSize is the most entries sent in one push, BatchWait how long entries are held back to fill a batch.
+	BatchSize int
+	BatchWait time.Duration
+	// Timeout bounds every push request.
+	Timeout time.Duration
+	// Retry configures the retries of pushes failing with a transport error, a 429 or a 5xx.
+	Retry RetryPolicy
+}
+
+// LokiSink pushes the forwarded log entries in batches to the push API of Loki. Every entry is a logfmt line of a
+// stream labelled with the target, the resource, the log service and the severity of the entry.
+type LokiSink struct {
+	*sinkWorker
+	options LokiSinkOptions
+	client  *http.Client
+}
+
+// lokiPush is the body of a request to the push API.
+type lokiPush struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// NewLokiSink returns a LokiSink and starts forwarding the entries sent to it.
+func NewLokiSink(options LokiSinkOptions, logger *log.Entry) *LokiSink {
+	if options.Timeout == 0 {
+		options.Timeout = defaultSinkTimeout
+	}
+	s := &LokiSink{
+		options: options,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: options.TLSConfig,
+			},
+			Timeout: options.Timeout,
+		},
+	}
+	s.sinkWorker = newSinkWorker("loki", options.BatchSize, options.BatchWait, s.push, logger)
+	return s
+}
+
+// push sends a batch of entries to the push API.
+func (s *LokiSink) push(batch []ForwardedLogEntry) {
+	body, err := json.Marshal(lokiPayload(batch))
+	if err == nil {
+		err = s.retry(s.options.Retry, func() (bool, error) {
+			return s.send(body)
+		})
+	}
+	s.record(batch, err)
+}
+
+// send posts the encoded batch once and reports whether a failure is worth retrying.
+func (s *LokiSink) send(body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.options.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.options.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", s.options.TenantID)
+	}
+	if s.options.Username != "" {
+		req.SetBasicAuth(s.options.Username, s.options.Password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	err = fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError, err
+}
+
+// lokiPayload groups the entries into streams by their labels, the values of every stream are ordered by time.
+func lokiPayload(batch []ForwardedLogEntry) lokiPush {
+	batch = append([]ForwardedLogEntry(nil), batch...)
+	sort.SliceStable(batch, func(i, j int) bool {
+		return batch[i].Created.Before(batch[j].Created)
+	})
+	streams := make(map[string]*lokiStream)
+	var keys []string
+	for i := range batch {
+		entry := &batch[i]
+		labels := map[string]string{
+			"target":                entry.Target,
+			entry.Subsystem + "_id": entry.ResourceID,
+			"log_service":           entry.LogService,
+			"log_service_id":        entry.LogServiceID,
+			"severity":              entry.Severity,
+		}
+		key := fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%s\x00%s", entry.Target, entry.Subsystem, entry.ResourceID, entry.LogService, entry.LogServiceID, entry.Severity)
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{Stream: labels}
+			streams[key] = stream
+			keys = append(keys, key)
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(entry.Created.UnixNano(), 10), entry.logfmt()})
+	}
+
+	push := lokiPush{Streams: make([]lokiStream, 0, len(keys))}
+	for _, key := range keys {
+		push.Streams = append(push.Streams, *streams[key])
+	}
+	return push
+}
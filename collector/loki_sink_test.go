@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLokiPayload(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	entry := func(target, severity, id string, seconds int) ForwardedLogEntry {
+		return ForwardedLogEntry{
+			Target:       target,
+			Subsystem:    "system",
+			ResourceID:   "1",
+			LogService:   "System Event Log",
+			LogServiceID: "SEL",
+			EntryID:      id,
+			Severity:     severity,
+			Created:      start.Add(time.Duration(seconds) * time.Second),
+		}
+	}
+	labels := func(target, severity string) map[string]string {
+		return map[string]string{
+			"target":         target,
+			"system_id":      "1",
+			"log_service":    "System Event Log",
+			"log_service_id": "SEL",
+			"severity":       severity,
+		}
+	}
+	value := func(id string, seconds int) [2]string {
+		return [2]string{strconv.FormatInt(start.Add(time.Duration(seconds)*time.Second).UnixNano(), 10), "entry_id=" + id}
+	}
+
+	push := lokiPayload([]ForwardedLogEntry{
+		entry("bmc1", "Warning", "3", 30),
+		entry("bmc1", "Critical", "2", 20),
+		entry("bmc2", "Warning", "1", 10),
+		entry("bmc1", "Warning", "1", 10),
+	})
+	// a stream per target and severity, in the order of their oldest entry, with the values ordered by time
+	want := []lokiStream{
+		{Stream: labels("bmc2", "Warning"), Values: [][2]string{value("1", 10)}},
+		{Stream: labels("bmc1", "Warning"), Values: [][2]string{value("1", 10), value("3", 30)}},
+		{Stream: labels("bmc1", "Critical"), Values: [][2]string{value("2", 20)}},
+	}
+	if !reflect.DeepEqual(push.Streams, want) {
+		t.Errorf("lokiPayload() =\n%+v\nwant\n%+v", push.Streams, want)
+	}
+}
+
+func TestForwardedLogEntryLogfmt(t *testing.T) {
+	tests := []struct {
+		entry ForwardedLogEntry
+		want  string
+	}{
+		{ForwardedLogEntry{}, ""},
+		{ForwardedLogEntry{EntryID: "1"}, "entry_id=1"},
+		{
+			ForwardedLogEntry{Message: "Fan 1 failed.", MessageID: "Oem.1.0.FanFailed", EntryID: "1", Resolution: "Replace the fan."},
+			`msg="Fan 1 failed." message_id=Oem.1.0.FanFailed entry_id=1 resolution="Replace the fan."`,
+		},
+		{ForwardedLogEntry{Message: `value "on"`}, `msg="value \"on\""`},
+		{ForwardedLogEntry{Message: `C:\BIOS`}, `msg="C:\\BIOS"`},
+		{ForwardedLogEntry{Message: "a=b"}, `msg="a=b"`},
+		{ForwardedLogEntry{Message: "line\nbreak\ttab"}, `msg="line\nbreak\ttab"`},
+	}
+	for _, test := range tests {
+		if got := test.entry.logfmt(); got != test.want {
+			t.Errorf("logfmt() of %+v = %s, want %s", test.entry, got, test.want)
+		}
+	}
+}
@@ -1,8 +1,8 @@
 package collector
 
 import (
+	"context"
 	"fmt"
-	"sync"
 
 	"github.com/apex/log"
 	"github.com/prometheus/client_golang/prometheus"
@@ -14,16 +14,23 @@ var (
 	ManagerSubmanager = "manager"
 	ManagerLabelNames = []string{"manager_id", "name", "model", "type"}
 
-	ManagerLogServiceLabelNames = []string{"manager_id", "log_service", "log_service_id", "log_service_enabled", "log_service_overwrite_policy"}
-	ManagerLogEntryLabelNames   = []string{"manager_id", "log_service", "log_service_id", "log_entry", "log_entry_id", "log_entry_code", "log_entry_type", "log_entry_message_id", "log_entry_sensor_number", "log_entry_sensor_type"}
+	ManagerLogServiceLabelNames    = []string{"manager_id", "log_service", "log_service_id", "log_service_enabled", "log_service_overwrite_policy"}
+	ManagerLogEntryCountLabelNames = []string{"manager_id", "log_service", "log_service_id", "severity"}
+	ManagerLogEntryTotalLabelNames = []string{"manager_id", "log_service", "log_service_id", "severity", "message_id"}
+	ManagerLogEntryLabelNames      = []string{"manager_id", "log_service", "log_service_id", "log_entry", "log_entry_id", "log_entry_code", "log_entry_type", "log_entry_message_id", "log_entry_sensor_number", "log_entry_sensor_type", "log_entry_message"}
 
 	managerMetrics = createManagerMetricMap()
 )
 
 // ManagerCollector implements the prometheus.Collector.
 type ManagerCollector struct {
+	ctx                   context.Context
 	redfishClient         *gofish.APIClient
+	pool                  *WorkerPool
+	logs                  *TargetLogs
 	metrics               map[string]Metric
+	options               *ScrapeOptions
+	scrapeErrors          *ScrapeErrors
 	collectorScrapeStatus *prometheus.GaugeVec
 	Log                   *log.Entry
 }
@@ -36,16 +43,24 @@ func createManagerMetricMap() map[string]Metric {
 
 	addToMetricMap(managerMetrics, ManagerSubmanager, "log_service_state", fmt.Sprintf("manager log service state,%s", CommonStateHelp), ManagerLogServiceLabelNames)
 	addToMetricMap(managerMetrics, ManagerSubmanager, "log_service_health_state", fmt.Sprintf("manager log service health state,%s", CommonHealthHelp), ManagerLogServiceLabelNames)
+	addToMetricMap(managerMetrics, ManagerSubmanager, "log_entries", "manager log entries by log service and severity", ManagerLogEntryCountLabelNames)
+	addToMetricMap(managerMetrics, ManagerSubmanager, "log_entry_newest_timestamp_seconds", "manager creation time of the newest log entry by log service and severity, in seconds since the epoch", ManagerLogEntryCountLabelNames)
+	addToMetricMap(managerMetrics, ManagerSubmanager, "log_entries_total", "manager log entries seen by log service, severity and message ID when log entries are fetched incrementally", ManagerLogEntryTotalLabelNames)
 	addToMetricMap(managerMetrics, ManagerSubmanager, "log_entry_severity_state", fmt.Sprintf("manager log entry severity state,%s", CommonSeverityHelp), ManagerLogEntryLabelNames)
 
 	return managerMetrics
 }
 
 // NewManagerCollector returns a collector that collecting memory statistics
-func NewManagerCollector(redfishClient *gofish.APIClient, logger *log.Entry) *ManagerCollector {
+func NewManagerCollector(ctx context.Context, redfishClient *gofish.APIClient, pool *WorkerPool, logs *TargetLogs, options *ScrapeOptions, scrapeErrors *ScrapeErrors, logger *log.Entry) *ManagerCollector {
 	return &ManagerCollector{
+		ctx:           ctx,
 		redfishClient: redfishClient,
+		pool:          pool,
+		logs:          logs,
 		metrics:       managerMetrics,
+		options:       options,
+		scrapeErrors:  scrapeErrors,
 		Log: logger.WithFields(log.Fields{
 			"collector": "ManagerCollector",
 		}),
@@ -53,7 +68,7 @@ func NewManagerCollector(redfishClient *gofish.APIClient, logger *log.Entry) *Ma
 			prometheus.GaugeOpts{
 				Namespace: namespace,
 				Name:      "collector_scrape_status",
-				Help:      "collector_scrape_status",
+				Help:      "collector scrape status,1(Success),0(Failure) if the collector could not list its resources",
 			},
 			[]string{"collector"},
 		),
@@ -74,12 +89,21 @@ func (m *ManagerCollector) Collect(ch chan<- prometheus.Metric) {
 	collectorLogContext := m.Log
 	//get service
 	service := m.redfishClient.Service
+	tasks := m.pool.NewTaskGroup(m.ctx)
 
 	// get a list of managers from service
+	listed := false
 	if managers, err := service.Managers(); err != nil {
 		collectorLogContext.WithField("operation", "service.Managers()").WithError(err).Error("error getting managers from service")
+		m.scrapeErrors.add("manager", "service.Managers()")
 	} else {
+		listed = true
 		for _, manager := range managers {
+			if m.ctx.Err() != nil {
+				collectorLogContext.WithError(m.ctx.Err()).Warn("scrape deadline reached, skipping remaining managers")
+				break
+			}
+			manager := manager
 			managerLogContext := collectorLogContext.WithField("Manager", manager.ID)
 			managerLogContext.Info("collector scrape started")
 			// overall manager metrics
@@ -104,26 +128,34 @@ func (m *ManagerCollector) Collect(ch chan<- prometheus.Metric) {
 			}
 
 			// process log services
-			logServices, err := manager.LogServices()
-			if err != nil {
-				managerLogContext.WithField("operation", "manager.LogServices()").WithError(err).Error("error getting log services from manager")
-			} else if logServices == nil {
-				managerLogContext.WithField("operation", "manager.LogServices()").Info("no log services found")
-			} else {
-				wg := &sync.WaitGroup{}
-				wg.Add(len(logServices))
-
-				for _, logService := range logServices {
-					if err = parseLogService(ch, managerMetrics, ManagerSubmanager, ManagerID, logService, wg); err != nil {
-						managerLogContext.WithField("operation", "manager.LogServices()").WithError(err).Error("error getting log entries from log service")
+			if m.options.resourceEnabled("manager", "log_services") {
+				tasks.Go(func() {
+					logServices, err := manager.LogServices()
+					if err != nil {
+						managerLogContext.WithField("operation", "manager.LogServices()").WithError(err).Error("error getting log services from manager")
+						m.scrapeErrors.add("manager", "manager.LogServices()")
+					} else if logServices == nil {
+						managerLogContext.WithField("operation", "manager.LogServices()").Info("no log services found")
+					} else {
+						for _, logService := range logServices {
+							logService := logService
+							tasks.Go(func() {
+								if err := parseLogService(ch, managerMetrics, ManagerSubmanager, ManagerID, logService, m.options.logEntryOptions(), m.logs); err != nil {
+									managerLogContext.WithField("operation", "manager.LogServices()").WithError(err).Error("error getting log entries from log service")
+									m.scrapeErrors.add("manager", "manager.LogServices()")
+								}
+							})
+						}
 					}
-				}
+				})
 			}
-
-			managerLogContext.Info("collector scrape completed")
 		}
-		m.collectorScrapeStatus.WithLabelValues("manager").Set(float64(1))
-
 	}
 
+	// every metric has to be sent before Collect returns
+	tasks.Wait()
+	collectorLogContext.Info("collector scrape completed")
+
+	m.collectorScrapeStatus.WithLabelValues("manager").Set(boolToFloat64(listed))
+	m.collectorScrapeStatus.Collect(ch)
 }
@@ -0,0 +1,253 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	gofish "github.com/stmcginnis/gofish"
+	"github.com/stmcginnis/gofish/redfish"
+)
+
+// registryRetryInterval is how long a target whose registries could not be listed is resolved with the bundled
+// registries only.
+const registryRetryInterval = 10 * time.Minute
+
+// MessageRegistries resolves the message IDs of log entries to their message, severity and resolution, using the
+// message registries of the targets, fetched once and cached, and the common messages of the Base and ResourceEvent
+// registries bundled with the exporter.
+type MessageRegistries struct {
+	mu      sync.Mutex
+	targets map[string]*targetRegistries
+	Log     *log.Entry
+}
+
+// targetRegistries are the message registries of one target, they are fetched when a message ID of a registry is
+// first resolved. mu is never held during a request, the scrapes resolving a message ID of a registry that is being
+// fetched wait for that fetch instead.
+type targetRegistries struct {
+	mu         sync.Mutex
+	files      []*redfish.MessageRegistryFile
+	listed     time.Time
+	listing    chan struct{}
+	registries map[string]*redfish.MessageRegistry
+	fetches    map[string]*registryFetch
+}
+
+// registryFetch is a fetch of a registry of a target in progress, registry is set once done is closed.
+type registryFetch struct {
+	done     chan struct{}
+	registry *redfish.MessageRegistry
+}
+
+// resolvedMessage is the message of a log entry as defined by its registry.
+type resolvedMessage struct {
+	Message    string
+	Severity   string
+	Resolution string
+}
+
+// NewMessageRegistries returns an empty MessageRegistries.
+func NewMessageRegistries(logger *log.Entry) *MessageRegistries {
+	return &MessageRegistries{
+		targets: make(map[string]*targetRegistries),
+		Log:     logger,
+	}
+}
+
+func (r *MessageRegistries) target(host string) *targetRegistries {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	registries, ok := r.targets[host]
+	if !ok {
+		registries = &targetRegistries{
+			registries: make(map[string]*redfish.MessageRegistry),
+			fetches:    make(map[string]*registryFetch),
+		}
+		r.targets[host] = registries
+	}
+	return registries
+}
+
+// resolve looks up the message ID in the registries of the target behind service, falling back to the bundled
+// registries.
+func (r *MessageRegistries) resolve(host string, service *gofish.Service, messageID string) (resolvedMessage, bool) {
+	prefix, major, minor, key, ok := parseMessageID(messageID)
+	if !ok {
+		return resolvedMessage{}, false
+	}
+	message, found := r.target(host).lookup(service, prefix, major, minor, key, r.Log.WithField("target", host))
+	if !found {
+		message, found = bundledMessage(prefix, major, key)
+	}
+	if !found {
+		return resolvedMessage{}, false
+	}
+	severity := message.MessageSeverity
+	if severity == "" {
+		severity = message.Severity
+	}
+	return resolvedMessage{
+		Message:    message.Message,
+		Severity:   severity,
+		Resolution: message.Resolution,
+	}, true
+}
+
+// lookup returns the message with the key from the registry of the target with the prefix and major version, the
+// one with the closest minor version when there are several.
+func (t *targetRegistries) lookup(service *gofish.Service, prefix string, major, minor int, key string, logger *log.Entry) (redfish.MessageRegistryMessage, bool) {
+	if service == nil {
+		return redfish.MessageRegistryMessage{}, false
+	}
+
+	var file *redfish.MessageRegistryFile
+	bestMinor := -1
+	for _, candidate := range t.listFiles(service, logger) {
+		candidatePrefix, candidateMajor, candidateMinor, ok := parseRegistryName(candidate.Registry)
+		if !ok || candidatePrefix != prefix || candidateMajor != major {
+			continue
+		}
+		if file == nil || absInt(candidateMinor-minor) < absInt(bestMinor-minor) {
+			file = candidate
+			bestMinor = candidateMinor
+		}
+	}
+	if file == nil {
+		return redfish.MessageRegistryMessage{}, false
+	}
+
+	registry := t.registry(service, file, logger)
+	if registry == nil {
+		return redfish.MessageRegistryMessage{}, false
+	}
+	message, ok := registry.Messages[key]
+	return message, ok
+}
+
+// listFiles returns the registry files of the target, listing them unless they were listed before or the listing
+// failed less than registryRetryInterval ago. Concurrent callers share one listing.
+func (t *targetRegistries) listFiles(service *gofish.Service, logger *log.Entry) []*redfish.MessageRegistryFile {
+	t.mu.Lock()
+	if listing := t.listing; listing != nil {
+		t.mu.Unlock()
+		<-listing
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		return t.files
+	}
+	if t.files != nil || time.Since(t.listed) <= registryRetryInterval {
+		defer t.mu.Unlock()
+		return t.files
+	}
+	t.listed = time.Now()
+	listing := make(chan struct{})
+	t.listing = listing
+	t.mu.Unlock()
+
+	files, err := service.Registries()
+	if err != nil {
+		logger.WithField("operation", "service.Registries()").WithError(err).Warn("error listing message registries, using the bundled ones")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.files = files
+	t.listing = nil
+	close(listing)
+	return files
+}
+
+// registry returns the registry of the file, fetching it unless it was fetched before. Concurrent callers share one
+// fetch per registry.
+func (t *targetRegistries) registry(service *gofish.Service, file *redfish.MessageRegistryFile, logger *log.Entry) *redfish.MessageRegistry {
+	t.mu.Lock()
+	if registry, ok := t.registries[file.Registry]; ok {
+		t.mu.Unlock()
+		return registry
+	}
+	if fetch, ok := t.fetches[file.Registry]; ok {
+		t.mu.Unlock()
+		<-fetch.done
+		return fetch.registry
+	}
+	fetch := &registryFetch{done: make(chan struct{})}
+	t.fetches[file.Registry] = fetch
+	t.mu.Unlock()
+
+	if uri := registryURI(file); uri != "" {
+		fetched, err := redfish.GetMessageRegistry(service.Client, uri)
+		if err != nil {
+			logger.WithField("operation", "redfish.GetMessageRegistry()").WithField("registry", file.Registry).WithError(err).Warn("error getting message registry")
+		} else {
+			fetch.registry = fetched
+		}
+	}
+	t.mu.Lock()
+	// a registry that can not be fetched is not requested again
+	t.registries[file.Registry] = fetch.registry
+	delete(t.fetches, file.Registry)
+	t.mu.Unlock()
+	close(fetch.done)
+	return fetch.registry
+}
+
+// registryURI returns the location of the english registry served by the target, remote publication URIs are not
+// fetched.
+func registryURI(file *redfish.MessageRegistryFile) string {
+	uri := ""
+	for _, location := range file.Location {
+		if location.URI == "" {
+			continue
+		}
+		if location.Language == "en" {
+			return location.URI
+		}
+		if uri == "" {
+			uri = location.URI
+		}
+	}
+	return uri
+}
+
+// parseMessageID splits a message ID such as Base.1.8.PropertyValueNotInList into its registry prefix, major and
+// minor version and message key.
+func parseMessageID(messageID string) (prefix string, major int, minor int, key string, ok bool) {
+	parts := strings.Split(messageID, ".")
+	if len(parts) < 4 {
+		return "", 0, 0, "", false
+	}
+	major, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, 0, "", false
+	}
+	minor, err = strconv.Atoi(parts[2])
+	if err != nil {
+		return "", 0, 0, "", false
+	}
+	return parts[0], major, minor, parts[len(parts)-1], true
+}
+
+// parseRegistryName splits a registry name such as Base.1.8 or Base.1.8.0 into its prefix, major and minor version.
+func parseRegistryName(name string) (prefix string, major int, minor int, ok bool) {
+	prefix, major, minor, _, ok = parseMessageID(name + ".key")
+	return
+}
+
+// substituteMessageArgs replaces the %1, %2, ... placeholders of the message with the args.
+func substituteMessageArgs(message string, args []string) string {
+	// the highest placeholders first, so that %1 does not match the start of %10
+	for i := len(args); i > 0; i-- {
+		message = strings.Replace(message, fmt.Sprintf("%%%d", i), args[i-1], -1)
+	}
+	return message
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
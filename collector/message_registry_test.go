@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/apex/log"
+	gofish "github.com/stmcginnis/gofish"
+)
+
+func TestBundledRegistries(t *testing.T) {
+	registries, err := loadBundledRegistries()
+	if err != nil {
+		t.Fatalf("loadBundledRegistries() = %s", err)
+	}
+	for _, key := range []string{"Base.1", "ResourceEvent.1"} {
+		if registries[key] == nil || len(registries[key].Messages) == 0 {
+			t.Errorf("bundled registry %s is missing", key)
+		}
+	}
+	message, ok := bundledMessage("Base", 1, "PropertyValueNotInList")
+	if !ok || message.Message == "" || message.MessageSeverity != "Warning" {
+		t.Errorf("bundledMessage(Base, 1, PropertyValueNotInList) = %+v, %t", message, ok)
+	}
+	if _, ok := bundledMessage("Base", 2, "PropertyValueNotInList"); ok {
+		t.Errorf("bundledMessage() of another major version found a message")
+	}
+}
+
+func TestLoadRegistryFiles(t *testing.T) {
+	files := fstest.MapFS{
+		"registries/Base.1.json":     {Data: []byte(`{"RegistryPrefix": "Base", "RegistryVersion": "1", "Messages": {"Success": {"Message": "bundled"}}}`)},
+		"registries/Base.1.8.0.json": {Data: []byte(`{"RegistryPrefix": "Base", "RegistryVersion": "1.8.0", "Messages": {"Success": {"Message": "1.8"}}}`)},
+		"registries/Base.1.2.0.json": {Data: []byte(`{"RegistryPrefix": "Base", "RegistryVersion": "1.2.0", "Messages": {"Success": {"Message": "1.2"}}}`)},
+		"registries/Base.2.json":     {Data: []byte(`{"RegistryPrefix": "Base", "RegistryVersion": "2", "Messages": {"Success": {"Message": "bundled 2"}}}`)},
+	}
+	registries, err := loadRegistryFiles(files)
+	if err != nil {
+		t.Fatalf("loadRegistryFiles() = %s", err)
+	}
+	// registry files with a minor version take precedence over the bundled messages of their major version
+	for key, want := range map[string]string{"Base.1": "1.8", "Base.2": "bundled 2"} {
+		if registries[key] == nil || registries[key].Messages["Success"].Message != want {
+			t.Errorf("message of registry %s = %+v, want %s", key, registries[key], want)
+		}
+	}
+
+	files["registries/Broken.json"] = &fstest.MapFile{Data: []byte(`{"RegistryPrefix": "Broken", "RegistryVersion": "v1"}`)}
+	if _, err := loadRegistryFiles(files); err == nil {
+		t.Errorf("loadRegistryFiles() of a registry file without a version did not fail")
+	}
+}
+
+// fakeRegistryService serves an OEM message registry, it answers the fetch of the registry slowly so that
+// concurrent lookups overlap.
+type fakeRegistryService struct {
+	mu      sync.Mutex
+	fetches int
+}
+
+func (s *fakeRegistryService) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/redfish/v1/":
+		fmt.Fprint(w, `{"@odata.id": "/redfish/v1/", "Registries": {"@odata.id": "/redfish/v1/Registries"}}`)
+	case "/redfish/v1/Registries":
+		fmt.Fprint(w, `{"Members": [{"@odata.id": "/redfish/v1/Registries/Oem"}], "Members@odata.count": 1}`)
+	case "/redfish/v1/Registries/Oem":
+		fmt.Fprint(w, `{"@odata.id": "/redfish/v1/Registries/Oem", "Id": "Oem", "Registry": "Oem.1.2", "Location": [{"Language": "en", "Uri": "/redfish/v1/Registries/Oem/Oem.json"}]}`)
+	case "/redfish/v1/Registries/Oem/Oem.json":
+		s.mu.Lock()
+		s.fetches++
+		s.mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprint(w, `{"@odata.id": "/redfish/v1/Registries/Oem/Oem.json", "RegistryPrefix": "Oem", "RegistryVersion": "1.2.0", "Messages": {"FanFailed": {"Message": "Fan %1 failed.", "MessageSeverity": "Critical", "Resolution": "Replace the fan."}}}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestMessageRegistriesFetchOnce(t *testing.T) {
+	fake := &fakeRegistryService{}
+	server := httptest.NewServer(http.HandlerFunc(fake.serveHTTP))
+	defer server.Close()
+	client, err := gofish.ConnectContext(context.Background(), gofish.ClientConfig{Endpoint: server.URL, HTTPClient: server.Client()})
+	if err != nil {
+		t.Fatalf("ConnectContext() = %s", err)
+	}
+	registries := NewMessageRegistries(log.WithField("test", t.Name()))
+
+	var wg sync.WaitGroup
+	// the listing of the registries is done once the first lookup returns
+	registries.resolve("bmc", client.Service, "Base.1.0.Success")
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			message, ok := registries.resolve("bmc", client.Service, "Oem.1.0.FanFailed")
+			if !ok || message.Message != "Fan %1 failed." || message.Severity != "Critical" {
+				t.Errorf("resolve(Oem.1.0.FanFailed) = %+v, %t", message, ok)
+			}
+		}()
+	}
+	// lookups of other registries do not wait for the fetch
+	time.Sleep(10 * time.Millisecond)
+	start := time.Now()
+	if _, ok := registries.resolve("bmc", client.Service, "Base.1.0.Success"); !ok {
+		t.Errorf("resolve(Base.1.0.Success) found no message")
+	}
+	if elapsed := time.Since(start); elapsed > 30*time.Millisecond {
+		t.Errorf("resolve() during the fetch of another registry took %s", elapsed)
+	}
+	wg.Wait()
+	if fake.fetches != 1 {
+		t.Errorf("registry fetched %d times, want once", fake.fetches)
+	}
+
+	// the bundled registries resolve the message IDs of registries the target does not serve
+	if message, ok := registries.resolve("bmc", client.Service, "ResourceEvent.1.0.ResourceStatusChangedCritical"); !ok || message.Severity != "Critical" {
+		t.Errorf("resolve(ResourceEvent.1.0.ResourceStatusChangedCritical) = %+v, %t", message, ok)
+	}
+}
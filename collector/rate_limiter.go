@@ -0,0 +1,139 @@
+package collector
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TargetLimits bounds the redfish requests sent to one target, a zero value means no limit.
+type TargetLimits struct {
+	// MaxConcurrentRequests is the number of requests that may be in flight at the same time.
+	MaxConcurrentRequests int
+	// RequestsPerSecond is the rate at which requests are started.
+	RequestsPerSecond float64
+}
+
+// targetLimiter enforces the TargetLimits of one target for all clients talking to it.
+type targetLimiter struct {
+	mu       sync.Mutex
+	limits   TargetLimits
+	next     time.Time
+	inFlight int
+	// released is closed and replaced whenever a request leaves, waking the requests waiting for a slot.
+	released chan struct{}
+}
+
+var targetLimiters = struct {
+	sync.Mutex
+	m map[string]*targetLimiter
+}{m: make(map[string]*targetLimiter)}
+
+// limiterFor returns the limiter shared by all clients of host. Changed limits are applied to it in place, the
+// requests in flight and the rate already used keep counting against the new limits.
+func limiterFor(host string, limits TargetLimits) *targetLimiter {
+	targetLimiters.Lock()
+	defer targetLimiters.Unlock()
+	limiter, ok := targetLimiters.m[host]
+	if !ok {
+		limiter = &targetLimiter{released: make(chan struct{})}
+		targetLimiters.m[host] = limiter
+	}
+	limiter.mu.Lock()
+	limiter.limits = limits
+	limiter.mu.Unlock()
+	return limiter
+}
+
+// acquire waits until the request may be sent or ctx is done, the returned func must be called once the request is
+// done.
+func (l *targetLimiter) acquire(ctx context.Context) (func(), error) {
+	l.mu.Lock()
+	if l.limits.RequestsPerSecond > 0 {
+		interval := time.Duration(float64(time.Second) / l.limits.RequestsPerSecond)
+		now := time.Now()
+		if l.next.Before(now) {
+			l.next = now
+		}
+		wait := l.next.Sub(now)
+		l.next = l.next.Add(interval)
+		l.mu.Unlock()
+
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+		}
+		l.mu.Lock()
+	}
+
+	for l.limits.MaxConcurrentRequests > 0 && l.inFlight >= l.limits.MaxConcurrentRequests {
+		released := l.released
+		l.mu.Unlock()
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		l.mu.Lock()
+	}
+	l.inFlight++
+	l.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			l.inFlight--
+			close(l.released)
+			l.released = make(chan struct{})
+			l.mu.Unlock()
+		})
+	}, nil
+}
+
+// limitedTransport is a http.RoundTripper applying the limits of a target to every request.
+type limitedTransport struct {
+	next    http.RoundTripper
+	limiter *targetLimiter
+}
+
+// RoundTrip implements http.RoundTripper, a request stays in flight until its response body is read or closed.
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := t.limiter.acquire(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releasingBody releases the in-flight slot of a request at EOF or when it is closed, whichever comes first.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *releasingBody) Close() error {
+	b.release()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterForKeepsState(t *testing.T) {
+	host := t.Name()
+	limiter := limiterFor(host, TargetLimits{MaxConcurrentRequests: 2})
+	release, err := limiter.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire() = %s", err)
+	}
+
+	// a scrape with other limits shares the limiter and the request in flight
+	if other := limiterFor(host, TargetLimits{MaxConcurrentRequests: 1}); other != limiter {
+		t.Fatalf("limiterFor() with other limits returned a new limiter")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.acquire(ctx); err == nil {
+		t.Fatalf("acquire() beyond the new limit = nil, want an error")
+	}
+
+	release()
+	release()
+	next, err := limiter.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire() after release = %s", err)
+	}
+	next()
+}
+
+func TestLimiterWaitsForRelease(t *testing.T) {
+	limiter := limiterFor(t.Name(), TargetLimits{MaxConcurrentRequests: 1})
+	release, err := limiter.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire() = %s", err)
+	}
+	acquired := make(chan struct{})
+	go func() {
+		next, err := limiter.acquire(context.Background())
+		if err != nil {
+			t.Errorf("acquire() = %s", err)
+			return
+		}
+		close(acquired)
+		next()
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquire() did not wait for the request in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("acquire() did not return after the request in flight was released")
+	}
+}
+
+func TestLimiterRate(t *testing.T) {
+	limiter := limiterFor(t.Name(), TargetLimits{RequestsPerSecond: 20})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		release, err := limiter.acquire(context.Background())
+		if err != nil {
+			t.Fatalf("acquire() = %s", err)
+		}
+		release()
+	}
+	// the first request starts right away, the two others 50ms apart
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("3 requests at 20 per second took %s, want at least 100ms", elapsed)
+	}
+}
@@ -2,8 +2,13 @@ package collector
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
 	"fmt"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/apex/log"
@@ -30,33 +35,263 @@ var (
 		"Collector time duration.",
 		nil, nil,
 	)
+	collectorScrapeDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "collector_scrape_duration_seconds"),
+		"Time the collector took to scrape the target.",
+		[]string{"collector"}, nil,
+	)
+	scrapeErrorsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "scrape_errors"),
+		"Number of failed redfish calls during the scrape, by collector and operation.",
+		[]string{"collector", "operation"}, nil,
+	)
+	scrapeRequestsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "scrape_requests"),
+		"Number of redfish requests sent during the scrape, retries included.",
+		nil, nil,
+	)
+	scrapeResponseBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "scrape_response_bytes"),
+		"Bytes of the redfish responses read during the scrape.",
+		nil, nil,
+	)
+	scrapeTruncatedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "scrape_truncated"),
+		"1 if the scrape was cut short by the scrape timeout and only returns the metrics gathered before it.",
+		nil, nil,
+	)
+	connectErrorDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "connect_error"),
+		"1 if the exporter could not connect to the redfish API, by reason: dns, tcp_timeout, tcp_refused, tcp, tls_handshake, auth, http_status, invalid_service_root, circuit_open, timeout or other.",
+		[]string{"reason"}, nil,
+	)
+	tlsHandshakeDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "tls_handshake_duration_seconds"),
+		"Duration of the TLS handshake of the connection to the redfish API.",
+		nil, nil,
+	)
+	serviceRootStatusCodeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "service_root_status_code"),
+		"HTTP status code returned for the redfish service root.",
+		nil, nil,
+	)
 )
 
+// Resources of the collectors that can be excluded from a scrape.
+var collectorResources = map[string][]string{
+	"chassis": {"thermal", "power", "sensors", "network_adapters", "physical_security", "log_services"},
+	"system":  {"memory", "processors", "storage", "pcie_devices", "network_interfaces", "ethernet_interfaces", "simple_storage", "pcie_functions", "log_services"},
+	"manager": {"log_services"},
+}
+
+// ScrapeOptions selects the collectors and resources of a scrape.
+type ScrapeOptions struct {
+	// Collectors lists the collectors to run, all of them when empty.
+	Collectors []string
+	// Exclude lists the resources to skip, either for all collectors (log_services) or for one (system.log_services).
+	Exclude []string
+	// LogEntries selects the series exported per log entry.
+	LogEntries LogEntryOptions
+	// Energy estimates the energy consumed by the chassis without an energy counter, it is only set for the
+	// polled targets.
+	Energy *EnergyEstimate
+}
+
+// LogEntryOptions bounds the series exported per log entry, the entries are always counted by log service and
+// severity.
+type LogEntryOptions struct {
+	// Detail enables a series per log entry.
+	Detail bool
+	// DetailLimit is the number of newest entries exported per log service, 0 for all of them.
+	DetailLimit int
+	// DetailMaxAge skips the entries created longer ago, 0 for none.
+	DetailMaxAge time.Duration
+	// Incremental only fetches the entries added since the previous scrape and counts them instead.
+	Incremental bool
+}
+
+// defaultRetainedLogEntries is the number of newest entries fetched incrementally that are kept for the detail series
+// of a log service when neither DetailLimit nor DetailMaxAge bound them.
+const defaultRetainedLogEntries = 100
+
+// Validate checks that the options only refer to known collectors and resources.
+func (o *ScrapeOptions) Validate() error {
+	for _, name := range o.Collectors {
+		if _, ok := collectorResources[name]; !ok {
+			return fmt.Errorf("unknown collector %s", name)
+		}
+	}
+	for _, name := range o.Exclude {
+		known := false
+		for collector, resources := range collectorResources {
+			for _, resource := range resources {
+				if name == resource || name == collector+"."+resource {
+					known = true
+				}
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown resource %s", name)
+		}
+	}
+	if o.LogEntries.DetailLimit < 0 {
+		return fmt.Errorf("log_entries.detail_limit must not be negative")
+	}
+	if o.LogEntries.DetailMaxAge < 0 {
+		return fmt.Errorf("log_entries.detail_max_age must not be negative")
+	}
+	return nil
+}
+
+func (o *ScrapeOptions) logEntryOptions() LogEntryOptions {
+	if o == nil {
+		return LogEntryOptions{}
+	}
+	return o.LogEntries
+}
+
+func (o *ScrapeOptions) energyEstimate() *EnergyEstimate {
+	if o == nil {
+		return nil
+	}
+	return o.Energy
+}
+
+func (o *ScrapeOptions) collectorEnabled(collector string) bool {
+	if o == nil || len(o.Collectors) == 0 {
+		return true
+	}
+	for _, name := range o.Collectors {
+		if name == collector {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *ScrapeOptions) resourceEnabled(collector, resource string) bool {
+	if o == nil {
+		return true
+	}
+	for _, name := range o.Exclude {
+		if name == resource || name == collector+"."+resource {
+			return false
+		}
+	}
+	return true
+}
+
+// ScrapeErrors counts the failed redfish calls of one scrape by collector and operation.
+type ScrapeErrors struct {
+	mu     sync.Mutex
+	counts map[[2]string]int
+}
+
+func newScrapeErrors() *ScrapeErrors {
+	return &ScrapeErrors{counts: make(map[[2]string]int)}
+}
+
+func (e *ScrapeErrors) add(collector, operation string) {
+	e.mu.Lock()
+	e.counts[[2]string{collector, operation}]++
+	e.mu.Unlock()
+}
+
+func (e *ScrapeErrors) collect(ch chan<- prometheus.Metric) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key, count := range e.counts {
+		ch <- prometheus.MustNewConstMetric(scrapeErrorsDesc, prometheus.GaugeValue, float64(count), key[0], key[1])
+	}
+}
+
 // RedfishCollector collects redfish metrics. It implements prometheus.Collector.
 type RedfishCollector struct {
+	ctx           context.Context
+	host          string
+	sessions      *SessionCache
 	redfishClient *gofish.APIClient
 	collectors    map[string]prometheus.Collector
+	scrapeErrors  *ScrapeErrors
+	connectTrace  *connectTrace
+	connectError  string
+	scrapeStats   *scrapeStats
+	logs          *TargetLogs
 	redfishUp     prometheus.Gauge
 }
 
-// NewRedfishCollector return RedfishCollector
-func NewRedfishCollector(host string, username string, password string, logger *log.Entry) *RedfishCollector {
-	var collectors map[string]prometheus.Collector
+// ClientOptions configures the http client talking to the redfish API of a target.
+type ClientOptions struct {
+	TLSConfig      *tls.Config
+	Limits         TargetLimits
+	Retry          RetryPolicy
+	CircuitBreaker CircuitBreakerPolicy
+}
+
+// fingerprint returns a digest of the options, clients created with options of the same fingerprint behave alike.
+func (o *ClientOptions) fingerprint() string {
+	digest := sha256.New()
+	fmt.Fprintf(digest, "%v|%v|%v", o.Limits, o.Retry, o.CircuitBreaker)
+	if config := o.TLSConfig; config != nil {
+		fmt.Fprintf(digest, "|%s|%t|%d", config.ServerName, config.InsecureSkipVerify, config.MinVersion)
+		for _, certificate := range config.Certificates {
+			for _, der := range certificate.Certificate {
+				digest.Write(der)
+			}
+		}
+		if config.RootCAs != nil {
+			// the pool is read from the ca_file, Subjects is reliable for it
+			for _, subject := range config.RootCAs.Subjects() {
+				digest.Write(subject)
+			}
+		}
+	}
+	return fmt.Sprintf("%x", digest.Sum(nil))
+}
+
+// NewRedfishCollector return RedfishCollector, every redfish call it makes is cancelled once ctx is done. The redfish
+// session is taken from sessions and created with the clientOptions, the fetches run on the pool. The log entries are
+// processed by the logPipeline.
+func NewRedfishCollector(ctx context.Context, sessions *SessionCache, pool *WorkerPool, logPipeline *LogPipeline, host string, username string, password string, clientOptions *ClientOptions, options *ScrapeOptions, logger *log.Entry) *RedfishCollector {
+	collectors := map[string]prometheus.Collector{}
+	scrapeErrors := newScrapeErrors()
 	collectorLogCtx := logger
-	redfishClient, err := newRedfishClient(host, username, password)
+	ctx, trace := withConnectTrace(ctx)
+	ctx, stats := withScrapeStats(ctx)
+	ctx = withPoolTarget(ctx, host)
+	connectError := ""
+	var logs *TargetLogs
+	if estimate := options.energyEstimate(); estimate != nil {
+		estimate.begin()
+	}
+	redfishClient, err := sessions.Acquire(ctx, host, username, password, clientOptions)
 	if err != nil {
-		collectorLogCtx.WithError(err).Error("error creating redfish client")
+		connectError = classifyConnectError(err, trace)
+		collectorLogCtx.WithField("reason", connectError).WithError(err).Error("error creating redfish client")
 	} else {
-		chassisCollector := NewChassisCollector(redfishClient, collectorLogCtx)
-		systemCollector := NewSystemCollector(redfishClient, collectorLogCtx)
-		managerCollector := NewManagerCollector(redfishClient, collectorLogCtx)
-
-		collectors = map[string]prometheus.Collector{"chassis": chassisCollector, "system": systemCollector, "manager": managerCollector}
+		logs = logPipeline.Target(host, redfishClient.Service)
+		if options.collectorEnabled("chassis") {
+			collectors["chassis"] = NewChassisCollector(ctx, redfishClient, pool, logs, options, scrapeErrors, collectorLogCtx)
+		}
+		if options.collectorEnabled("system") {
+			collectors["system"] = NewSystemCollector(ctx, redfishClient, pool, logs, options, scrapeErrors, collectorLogCtx)
+		}
+		if options.collectorEnabled("manager") {
+			collectors["manager"] = NewManagerCollector(ctx, redfishClient, pool, logs, options, scrapeErrors, collectorLogCtx)
+		}
 	}
 
 	return &RedfishCollector{
+		ctx:           ctx,
+		host:          host,
+		sessions:      sessions,
 		redfishClient: redfishClient,
 		collectors:    collectors,
+		scrapeErrors:  scrapeErrors,
+		connectTrace:  trace,
+		connectError:  connectError,
+		scrapeStats:   stats,
+		logs:          logs,
 		redfishUp: prometheus.NewGauge(
 			prometheus.GaugeOpts{
 				Namespace: namespace,
@@ -81,41 +316,66 @@ func (r *RedfishCollector) Collect(ch chan<- prometheus.Metric) {
 
 	scrapeTime := time.Now()
 	if r.redfishClient != nil {
-		defer r.redfishClient.Logout()
+		defer r.sessions.Release(r.host, r.redfishClient)
 		r.redfishUp.Set(1)
 		wg := &sync.WaitGroup{}
 		wg.Add(len(r.collectors))
 
-		for _, collector := range r.collectors {
-			go func(collector prometheus.Collector) {
+		for name, collector := range r.collectors {
+			go func(name string, collector prometheus.Collector) {
 				defer wg.Done()
+				collectorScrapeTime := time.Now()
 				collector.Collect(ch)
-			}(collector)
+				ch <- prometheus.MustNewConstMetric(collectorScrapeDurationDesc, prometheus.GaugeValue, time.Since(collectorScrapeTime).Seconds(), name)
+			}(name, collector)
 		}
 		wg.Wait()
+		r.scrapeErrors.collect(ch)
+		r.logs.collect(ch)
 	} else {
 		r.redfishUp.Set(0)
+		ch <- prometheus.MustNewConstMetric(connectErrorDesc, prometheus.GaugeValue, 1, r.connectError)
+	}
+	if duration, ok := r.connectTrace.handshake(); ok {
+		ch <- prometheus.MustNewConstMetric(tlsHandshakeDurationDesc, prometheus.GaugeValue, duration.Seconds())
+	}
+	if statusCode, ok := r.connectTrace.rootStatus(); ok {
+		ch <- prometheus.MustNewConstMetric(serviceRootStatusCodeDesc, prometheus.GaugeValue, float64(statusCode))
 	}
 
 	ch <- r.redfishUp
+	ch <- prometheus.MustNewConstMetric(scrapeTruncatedDesc, prometheus.GaugeValue, boolToFloat64(r.ctx.Err() != nil))
 	ch <- prometheus.MustNewConstMetric(totalScrapeDurationDesc, prometheus.GaugeValue, time.Since(scrapeTime).Seconds())
+	ch <- prometheus.MustNewConstMetric(scrapeRequestsDesc, prometheus.GaugeValue, float64(atomic.LoadInt64(&r.scrapeStats.requests)))
+	ch <- prometheus.MustNewConstMetric(scrapeResponseBytesDesc, prometheus.GaugeValue, float64(atomic.LoadInt64(&r.scrapeStats.bytes)))
 }
 
-func newRedfishClient(host string, username string, password string) (*gofish.APIClient, error) {
-
-	url := fmt.Sprintf("https://%s", host)
-
-	config := gofish.ClientConfig{
-		Endpoint: url,
-		Username: username,
-		Password: password,
-		Insecure: true,
+// newHTTPClient returns the http client used to talk to the redfish API of host, it mirrors the transport gofish
+// builds by default but with the TLS settings configured for the host, and applies its request limits, retries and
+// circuit breaker.
+func newHTTPClient(host string, clientOptions *ClientOptions) *http.Client {
+	defaultTransport := http.DefaultTransport.(*http.Transport)
+	transport := &http.Transport{
+		Proxy:                 defaultTransport.Proxy,
+		DialContext:           defaultTransport.DialContext,
+		MaxIdleConns:          defaultTransport.MaxIdleConns,
+		IdleConnTimeout:       defaultTransport.IdleConnTimeout,
+		ExpectContinueTimeout: defaultTransport.ExpectContinueTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		TLSClientConfig:       clientOptions.TLSConfig,
 	}
-	redfishClient, err := gofish.Connect(config)
-	if err != nil {
-		return nil, err
+	var roundTripper http.RoundTripper = &instrumentedTransport{next: transport}
+	if clientOptions.Limits != (TargetLimits{}) {
+		roundTripper = &limitedTransport{next: roundTripper, limiter: limiterFor(host, clientOptions.Limits)}
 	}
-	return redfishClient, nil
+	if clientOptions.Retry.MaxRetries > 0 || clientOptions.CircuitBreaker.FailureThreshold > 0 {
+		retry := &retryTransport{next: roundTripper, host: host, retry: clientOptions.Retry}
+		if clientOptions.CircuitBreaker.FailureThreshold > 0 {
+			retry.breaker = breakerFor(host, clientOptions.CircuitBreaker)
+		}
+		roundTripper = retry
+	}
+	return &http.Client{Transport: &traceTransport{next: roundTripper}}
 }
 
 func parseCommonStatusHealth(status gofishcommon.Health) (float64, bool) {
@@ -220,6 +480,20 @@ func parsePhySecReArmMethod(method redfish.IntrusionSensorReArm) (float64, bool)
 	return float64(0), false
 }
 
+func parsePowerLimitException(exception redfish.PowerLimitException) (float64, bool) {
+	switch exception {
+	case redfish.NoActionPowerLimitException:
+		return float64(1), true
+	case redfish.HardPowerOffPowerLimitException:
+		return float64(2), true
+	case redfish.LogEventOnlyPowerLimitException:
+		return float64(3), true
+	case redfish.OemPowerLimitException:
+		return float64(4), true
+	}
+	return float64(0), false
+}
+
 func parsePhySecIntrusionSensor(method redfish.IntrusionSensor) (float64, bool) {
 	if bytes.Equal([]byte(method), []byte("Normal")) {
 		return float64(1), true
@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"sync"
+
+	"github.com/stmcginnis/gofish/redfish"
+)
+
+// bundledRegistryFiles hold the common messages of registries, in the format of a message registry file, that resolve
+// the message IDs of targets that do not serve these registries. The files of the exporter only give the major
+// version of a registry, a registry file with a minor version dropped into the directory takes precedence over them
+// on the next build.
+//
+//go:embed registries/*.json
+var bundledRegistryFiles embed.FS
+
+var (
+	bundledRegistriesOnce sync.Once
+	// bundledRegistries holds the messages of the bundled registries keyed by registry prefix and major version, the
+	// newest minor version of each.
+	bundledRegistries map[string]*redfish.MessageRegistry
+)
+
+// loadBundledRegistries parses the embedded registry files.
+func loadBundledRegistries() (map[string]*redfish.MessageRegistry, error) {
+	return loadRegistryFiles(bundledRegistryFiles)
+}
+
+// loadRegistryFiles parses the registry files of the registries directory of files, keyed by registry prefix and
+// major version.
+func loadRegistryFiles(files fs.FS) (map[string]*redfish.MessageRegistry, error) {
+	entries, err := fs.ReadDir(files, "registries")
+	if err != nil {
+		return nil, err
+	}
+	registries := make(map[string]*redfish.MessageRegistry)
+	minors := make(map[string]int)
+	for _, entry := range entries {
+		content, err := fs.ReadFile(files, path.Join("registries", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var registry redfish.MessageRegistry
+		if err := json.Unmarshal(content, &registry); err != nil {
+			return nil, fmt.Errorf("error parsing registry file %s: %s", entry.Name(), err)
+		}
+		prefix, major, minor, ok := parseRegistryName(registry.RegistryPrefix + "." + registry.RegistryVersion)
+		if !ok {
+			// the messages of the exporter rank below every minor version
+			major, err = strconv.Atoi(registry.RegistryVersion)
+			prefix, minor, ok = registry.RegistryPrefix, -1, err == nil && registry.RegistryPrefix != ""
+		}
+		if !ok {
+			return nil, fmt.Errorf("registry file %s has an invalid prefix or version", entry.Name())
+		}
+		key := fmt.Sprintf("%s.%d", prefix, major)
+		if _, ok := registries[key]; ok && minors[key] >= minor {
+			continue
+		}
+		registries[key] = &registry
+		minors[key] = minor
+	}
+	return registries, nil
+}
+
+// bundledMessage returns the message with the key of the bundled registry with the prefix and major version.
+func bundledMessage(prefix string, major int, key string) (redfish.MessageRegistryMessage, bool) {
+	bundledRegistriesOnce.Do(func() {
+		registries, err := loadBundledRegistries()
+		if err != nil {
+			// the files are embedded at build time, a broken one is a bug
+			panic(err)
+		}
+		bundledRegistries = registries
+	})
+	registry, ok := bundledRegistries[fmt.Sprintf("%s.%d", prefix, major)]
+	if !ok {
+		return redfish.MessageRegistryMessage{}, false
+	}
+	message, ok := registry.Messages[key]
+	return message, ok
+}
@@ -0,0 +1,143 @@
+package collector
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var requestDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: exporter,
+		Name:      "request_duration_seconds",
+		Help:      "Duration of the redfish requests until their response was read, by resource class, method and status code.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	},
+	[]string{"resource", "method", "code"},
+)
+
+func init() {
+	prometheus.MustRegister(requestDuration)
+}
+
+// Redfish collections whose members are replaced by * in the resource class of a request, members of other
+// collections are only replaced when they contain a digit.
+var redfishCollections = map[string]bool{
+	"Chassis":                true,
+	"Controllers":            true,
+	"Drives":                 true,
+	"Entries":                true,
+	"EthernetInterfaces":     true,
+	"LogServices":            true,
+	"Managers":               true,
+	"Memory":                 true,
+	"NetworkAdapters":        true,
+	"NetworkDeviceFunctions": true,
+	"NetworkInterfaces":      true,
+	"NetworkPorts":           true,
+	"PCIeDevices":            true,
+	"PCIeFunctions":          true,
+	"Ports":                  true,
+	"PowerSupplies":          true,
+	"Processors":             true,
+	"Registries":             true,
+	"Sensors":                true,
+	"Sessions":               true,
+	"SimpleStorage":          true,
+	"Storage":                true,
+	"Systems":                true,
+	"Volumes":                true,
+}
+
+// resourceClass normalises the path of a redfish request into its resource class, e.g.
+// /redfish/v1/Systems/1/Memory/DIMM1 into Systems/*/Memory/*, so that the request metrics do not get a series per
+// resource.
+func resourceClass(path string) string {
+	path = strings.Trim(strings.TrimPrefix(path, "/redfish/v1"), "/")
+	if path == "" {
+		return "ServiceRoot"
+	}
+	segments := strings.Split(path, "/")
+	class := make([]string, len(segments))
+	for i, segment := range segments {
+		if (i > 0 && redfishCollections[segments[i-1]]) || strings.IndexAny(segment, "0123456789") >= 0 {
+			class[i] = "*"
+		} else {
+			class[i] = segment
+		}
+	}
+	return strings.Join(class, "/")
+}
+
+// scrapeStats counts the redfish requests of a scrape and the bytes of their responses.
+type scrapeStats struct {
+	requests int64
+	bytes    int64
+}
+
+type scrapeStatsKey struct{}
+
+// withScrapeStats returns a context counting the requests made with it in the returned scrapeStats.
+func withScrapeStats(ctx context.Context) (context.Context, *scrapeStats) {
+	stats := &scrapeStats{}
+	return context.WithValue(ctx, scrapeStatsKey{}, stats), stats
+}
+
+// instrumentedTransport is a http.RoundTripper recording every request in the request duration histogram and the
+// scrapeStats of its context.
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	stats, _ := req.Context().Value(scrapeStatsKey{}).(*scrapeStats)
+	if stats != nil {
+		atomic.AddInt64(&stats.requests, 1)
+	}
+	resource := resourceClass(req.URL.Path)
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		requestDuration.WithLabelValues(resource, req.Method, "error").Observe(time.Since(start).Seconds())
+		return resp, err
+	}
+	observer := requestDuration.WithLabelValues(resource, req.Method, strconv.Itoa(resp.StatusCode))
+	resp.Body = &instrumentedBody{ReadCloser: resp.Body, stats: stats, observe: func() {
+		observer.Observe(time.Since(start).Seconds())
+	}}
+	return resp, nil
+}
+
+// instrumentedBody counts the bytes read from a response body and observes the request duration at EOF or when it
+// is closed, whichever comes first.
+type instrumentedBody struct {
+	io.ReadCloser
+	stats   *scrapeStats
+	once    sync.Once
+	observe func()
+}
+
+func (b *instrumentedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.stats != nil {
+		atomic.AddInt64(&b.stats.bytes, int64(n))
+	}
+	if err != nil {
+		b.once.Do(b.observe)
+	}
+	return n, err
+}
+
+func (b *instrumentedBody) Close() error {
+	b.once.Do(b.observe)
+	return b.ReadCloser.Close()
+}
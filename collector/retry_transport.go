@@ -0,0 +1,234 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Circuit breaker states, as exported by redfish_exporter_circuit_breaker_state.
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+var (
+	circuitBreakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: exporter,
+			Name:      "circuit_breaker_state",
+			Help:      "circuit breaker state of a target,0(Closed),1(Open),2(HalfOpen)",
+		},
+		[]string{"target"},
+	)
+	requestRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: exporter,
+			Name:      "request_retries_total",
+			Help:      "Redfish requests retried after a transient failure.",
+		},
+		[]string{"target"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(circuitBreakerState, requestRetries)
+}
+
+// RetryPolicy configures the retries of idempotent requests failing with a transport error, a 429 or a 5xx.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt, 0 disables retries.
+	MaxRetries int
+	// InitialBackoff is the wait before the first retry, it doubles for every further retry up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// CircuitBreakerPolicy configures the circuit breaker of a target.
+type CircuitBreakerPolicy struct {
+	// FailureThreshold is the number of consecutive failed requests opening the breaker, 0 disables it.
+	FailureThreshold int
+	// Cooldown is how long the breaker stays open before a trial request is let through.
+	Cooldown time.Duration
+}
+
+const (
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 5 * time.Second
+	defaultCooldown       = time.Minute
+)
+
+// circuitBreaker fails the requests to a target fast after FailureThreshold consecutive failures, until a trial
+// request succeeds after the cooldown.
+type circuitBreaker struct {
+	host string
+
+	mu       sync.Mutex
+	policy   CircuitBreakerPolicy
+	state    int
+	failures int
+	openedAt time.Time
+}
+
+var circuitBreakers = struct {
+	sync.Mutex
+	m map[string]*circuitBreaker
+}{m: make(map[string]*circuitBreaker)}
+
+// breakerFor returns the breaker shared by all clients of host. A changed policy is applied to it in place, the state
+// of the breaker is kept.
+func breakerFor(host string, policy CircuitBreakerPolicy) *circuitBreaker {
+	if policy.Cooldown == 0 {
+		policy.Cooldown = defaultCooldown
+	}
+	circuitBreakers.Lock()
+	defer circuitBreakers.Unlock()
+	breaker, ok := circuitBreakers.m[host]
+	if !ok {
+		breaker = &circuitBreaker{host: host}
+		circuitBreakers.m[host] = breaker
+		circuitBreakerState.WithLabelValues(host).Set(breakerClosed)
+	}
+	breaker.mu.Lock()
+	breaker.policy = policy
+	breaker.mu.Unlock()
+	return breaker
+}
+
+// allow reports whether a request may be sent, once the cooldown is over a single trial request is allowed.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.policy.Cooldown {
+			return false
+		}
+		b.setState(breakerHalfOpen)
+		return true
+	case breakerHalfOpen:
+		return false
+	}
+	return true
+}
+
+// record updates the breaker with the outcome of a request, a request that was cancelled before the target
+// answered neither counts as success nor as failure.
+func (b *circuitBreaker) record(success bool, cancelled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case cancelled:
+		if b.state == breakerHalfOpen {
+			b.setState(breakerOpen)
+		}
+	case success:
+		b.failures = 0
+		b.setState(breakerClosed)
+	default:
+		b.failures++
+		if b.state == breakerHalfOpen || b.failures >= b.policy.FailureThreshold {
+			b.openedAt = time.Now()
+			b.setState(breakerOpen)
+		}
+	}
+}
+
+func (b *circuitBreaker) setState(state int) {
+	b.state = state
+	circuitBreakerState.WithLabelValues(b.host).Set(float64(state))
+}
+
+// retryTransport is a http.RoundTripper retrying idempotent requests and guarding the target with a circuit breaker.
+type retryTransport struct {
+	next    http.RoundTripper
+	host    string
+	retry   RetryPolicy
+	breaker *circuitBreaker
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.breaker != nil && !t.breaker.allow() {
+		return nil, fmt.Errorf("%w: %s", errCircuitOpen, t.host)
+	}
+
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+	backoff := t.retry.InitialBackoff
+	if backoff == 0 {
+		backoff = defaultInitialBackoff
+	}
+	maxBackoff := t.retry.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	var (
+		resp *http.Response
+		err  error
+	)
+	for attempt := 0; ; attempt++ {
+		resp, err = t.next.RoundTrip(req)
+		if !idempotent || attempt >= t.retry.MaxRetries || !retryable(req.Context(), resp, err) {
+			break
+		}
+
+		wait := backoff
+		if resp != nil {
+			if after, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && after > 0 {
+				wait = time.Duration(after) * time.Second
+			}
+			// drain the body so that the connection can be reused
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if wait > maxBackoff {
+			wait = maxBackoff
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			t.recordOutcome(req.Context(), nil, req.Context().Err())
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		requestRetries.WithLabelValues(t.host).Inc()
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+	t.recordOutcome(req.Context(), resp, err)
+	return resp, err
+}
+
+func (t *retryTransport) recordOutcome(ctx context.Context, resp *http.Response, err error) {
+	if t.breaker == nil {
+		return
+	}
+	failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+	t.breaker.record(!failed, err != nil && ctx.Err() != nil)
+}
+
+// retryable reports whether a request that got resp or err is worth retrying.
+func retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// scriptedTransport answers the requests with the given status codes in turn, and with the last one once they are
+// used up.
+type scriptedTransport struct {
+	mu       sync.Mutex
+	codes    []int
+	header   http.Header
+	attempts int
+}
+
+func (t *scriptedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	code := t.codes[len(t.codes)-1]
+	if t.attempts < len(t.codes) {
+		code = t.codes[t.attempts]
+	}
+	t.attempts++
+	return &http.Response{StatusCode: code, Header: t.header, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+}
+
+func newTestRequest(t *testing.T, ctx context.Context, method string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, method, "https://bmc/redfish/v1/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		codes        []int
+		policy       RetryPolicy
+		wantCode     int
+		wantAttempts int
+		// minimum duration of all backoffs
+		wantWait time.Duration
+	}{
+		{"success", http.MethodGet, []int{200}, RetryPolicy{MaxRetries: 2}, 200, 1, 0},
+		{"retried 503", http.MethodGet, []int{503, 200}, RetryPolicy{MaxRetries: 2, InitialBackoff: time.Millisecond}, 200, 2, time.Millisecond},
+		{"retried 429", http.MethodGet, []int{429, 200}, RetryPolicy{MaxRetries: 2, InitialBackoff: time.Millisecond}, 200, 2, time.Millisecond},
+		{"retries used up", http.MethodGet, []int{503}, RetryPolicy{MaxRetries: 2, InitialBackoff: time.Millisecond}, 503, 3, 3 * time.Millisecond},
+		{"backoff doubles", http.MethodGet, []int{500}, RetryPolicy{MaxRetries: 3, InitialBackoff: 10 * time.Millisecond, MaxBackoff: time.Second}, 500, 4, 70 * time.Millisecond},
+		{"backoff capped", http.MethodGet, []int{500}, RetryPolicy{MaxRetries: 3, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 10 * time.Millisecond}, 500, 4, 30 * time.Millisecond},
+		{"client error not retried", http.MethodGet, []int{404}, RetryPolicy{MaxRetries: 2}, 404, 1, 0},
+		{"post not retried", http.MethodPost, []int{503}, RetryPolicy{MaxRetries: 2}, 503, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &scriptedTransport{codes: tt.codes}
+			transport := &retryTransport{next: next, host: t.Name(), retry: tt.policy}
+			start := time.Now()
+			resp, err := transport.RoundTrip(newTestRequest(t, context.Background(), tt.method))
+			if err != nil {
+				t.Fatalf("RoundTrip() = %s", err)
+			}
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("status code = %d, want %d", resp.StatusCode, tt.wantCode)
+			}
+			if next.attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", next.attempts, tt.wantAttempts)
+			}
+			if elapsed := time.Since(start); elapsed < tt.wantWait {
+				t.Errorf("RoundTrip() took %s, want at least %s", elapsed, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestRetryTransportRetryAfter(t *testing.T) {
+	next := &scriptedTransport{codes: []int{503, 200}, header: http.Header{"Retry-After": []string{"30"}}}
+	transport := &retryTransport{next: next, host: t.Name(), retry: RetryPolicy{MaxRetries: 1, MaxBackoff: 20 * time.Millisecond}}
+	start := time.Now()
+	if _, err := transport.RoundTrip(newTestRequest(t, context.Background(), http.MethodGet)); err != nil {
+		t.Fatalf("RoundTrip() = %s", err)
+	}
+	// Retry-After is honoured up to the maximum backoff
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > 10*time.Second {
+		t.Errorf("RoundTrip() took %s, want the maximum backoff of 20ms", elapsed)
+	}
+}
+
+func TestRetryTransportCancelledBackoff(t *testing.T) {
+	next := &scriptedTransport{codes: []int{503}}
+	transport := &retryTransport{next: next, host: t.Name(), retry: RetryPolicy{MaxRetries: 5, InitialBackoff: time.Minute, MaxBackoff: time.Minute}}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := transport.RoundTrip(newTestRequest(t, ctx, http.MethodGet)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RoundTrip() = %v, want the deadline error", err)
+	}
+	if next.attempts != 1 {
+		t.Errorf("attempts = %d, want 1", next.attempts)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	host := t.Name()
+	circuitBreakers.Lock()
+	delete(circuitBreakers.m, host)
+	circuitBreakers.Unlock()
+	next := &scriptedTransport{codes: []int{500}}
+	transport := &retryTransport{next: next, host: host, breaker: breakerFor(host, CircuitBreakerPolicy{FailureThreshold: 2, Cooldown: 50 * time.Millisecond})}
+	roundTrip := func() error {
+		_, err := transport.RoundTrip(newTestRequest(t, context.Background(), http.MethodGet))
+		return err
+	}
+	assertState := func(want int) {
+		t.Helper()
+		if got := testutil.ToFloat64(circuitBreakerState.WithLabelValues(host)); got != float64(want) {
+			t.Errorf("circuit_breaker_state = %v, want %d", got, want)
+		}
+	}
+
+	assertState(breakerClosed)
+	for i := 0; i < 2; i++ {
+		if err := roundTrip(); err != nil {
+			t.Fatalf("RoundTrip() = %s", err)
+		}
+	}
+	assertState(breakerOpen)
+	if err := roundTrip(); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("RoundTrip() of an open breaker = %v, want errCircuitOpen", err)
+	}
+	if next.attempts != 2 {
+		t.Errorf("attempts = %d, want 2", next.attempts)
+	}
+
+	// a failed trial request opens the breaker again
+	time.Sleep(60 * time.Millisecond)
+	if err := roundTrip(); err != nil {
+		t.Fatalf("trial RoundTrip() = %s", err)
+	}
+	assertState(breakerOpen)
+	if err := roundTrip(); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("RoundTrip() after a failed trial = %v, want errCircuitOpen", err)
+	}
+
+	// a changed policy keeps the state
+	breakerFor(host, CircuitBreakerPolicy{FailureThreshold: 3, Cooldown: 50 * time.Millisecond})
+	assertState(breakerOpen)
+
+	// only one trial request is let through, its success closes the breaker
+	time.Sleep(60 * time.Millisecond)
+	if !transport.breaker.allow() {
+		t.Fatal("allow() after the cooldown = false, want a trial request")
+	}
+	assertState(breakerHalfOpen)
+	if transport.breaker.allow() {
+		t.Error("allow() while the trial request is running = true, want false")
+	}
+	transport.breaker.record(true, false)
+	assertState(breakerClosed)
+
+	// a cancelled trial request reopens the breaker
+	transport.breaker.record(false, false)
+	transport.breaker.record(false, false)
+	transport.breaker.record(false, false)
+	assertState(breakerOpen)
+	time.Sleep(60 * time.Millisecond)
+	transport.breaker.allow()
+	transport.breaker.record(false, true)
+	assertState(breakerOpen)
+}
@@ -0,0 +1,342 @@
+package collector
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	gofish "github.com/stmcginnis/gofish"
+)
+
+// logoutTimeout bounds the request deleting a session.
+const logoutTimeout = 10 * time.Second
+
+// SessionCache keeps one authenticated redfish session per target, credentials and client options alive across
+// scrapes, so that the BMC does not have to create and delete a session for every scrape.
+type SessionCache struct {
+	// mu guards the sessions and the users and lastUsed of every session, it is never held during a request.
+	mu       sync.Mutex
+	sessions map[string]*cachedSession
+	// leases maps the clients handed out by Acquire to their session until they are released.
+	leases      map[*gofish.APIClient]*cachedSession
+	idleTimeout time.Duration
+	Log         *log.Entry
+}
+
+type cachedSession struct {
+	endpoint string
+	username string
+	password string
+	// httpClient logs in again when the session is rejected, loginClient sends the login requests themselves.
+	httpClient  *http.Client
+	loginClient *http.Client
+	// users counts the scrapes using the session, lastUsed is when the last of them released it.
+	users    int
+	lastUsed time.Time
+
+	// loginMu serializes the logins to the session, mu guards session.
+	loginMu sync.Mutex
+	mu      sync.Mutex
+	session *gofish.Session
+	Log     *log.Entry
+}
+
+// NewSessionCache returns a SessionCache that logs out sessions unused for longer than idleTimeout. An idleTimeout
+// of 0 disables the reuse of sessions, every scrape then logs in and out again.
+func NewSessionCache(idleTimeout time.Duration, logger *log.Entry) *SessionCache {
+	return &SessionCache{
+		sessions:    make(map[string]*cachedSession),
+		leases:      make(map[*gofish.APIClient]*cachedSession),
+		idleTimeout: idleTimeout,
+		Log:         logger,
+	}
+}
+
+// Acquire returns a client for the host bound to ctx, reusing the cached session of the host when there is one and
+// logging in otherwise. The client must be handed back with Release once the scrape is done, the session is not
+// logged out while it is in use.
+func (s *SessionCache) Acquire(ctx context.Context, host string, username string, password string, clientOptions *ClientOptions) (*gofish.APIClient, error) {
+	url := fmt.Sprintf("https://%s", host)
+	if s.idleTimeout <= 0 {
+		return gofish.ConnectContext(ctx, gofish.ClientConfig{
+			Endpoint:   url,
+			Username:   username,
+			Password:   password,
+			HTTPClient: newHTTPClient(host, clientOptions),
+		})
+	}
+
+	key := fmt.Sprintf("%s|%s|%x|%s", host, username, sha256.Sum256([]byte(password)), clientOptions.fingerprint())
+	s.mu.Lock()
+	entry, ok := s.sessions[key]
+	if !ok {
+		loginClient := newHTTPClient(host, clientOptions)
+		entry = &cachedSession{
+			endpoint:    url,
+			username:    username,
+			password:    password,
+			loginClient: loginClient,
+			Log:         s.Log.WithField("endpoint", url),
+		}
+		entry.httpClient = &http.Client{Transport: &sessionTransport{next: loginClient.Transport, session: entry}}
+		s.sessions[key] = entry
+	}
+	entry.users++
+	s.mu.Unlock()
+
+	client, err := entry.connect(ctx)
+	if err != nil {
+		s.release(entry)
+		return nil, err
+	}
+	s.mu.Lock()
+	s.leases[client] = entry
+	s.mu.Unlock()
+	return client, nil
+}
+
+// Release is called once a scrape of host is done with the client, it logs out right away when sessions are not
+// reused.
+func (s *SessionCache) Release(host string, client *gofish.APIClient) {
+	if client == nil {
+		return
+	}
+	if s.idleTimeout > 0 {
+		s.mu.Lock()
+		entry, ok := s.leases[client]
+		delete(s.leases, client)
+		s.mu.Unlock()
+		if ok {
+			s.release(entry)
+		}
+		return
+	}
+	session, err := client.GetSession()
+	if err != nil {
+		return
+	}
+	deleteSession(s.Log.WithField("endpoint", fmt.Sprintf("https://%s", host)), client.HTTPClient, fmt.Sprintf("https://%s", host), session)
+}
+
+func (s *SessionCache) release(entry *cachedSession) {
+	s.mu.Lock()
+	entry.users--
+	entry.lastUsed = time.Now()
+	s.mu.Unlock()
+}
+
+// Run logs out idle sessions until ctx is done.
+func (s *SessionCache) Run(ctx context.Context) {
+	if s.idleTimeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.logoutIdle(time.Now())
+		}
+	}
+}
+
+// logoutIdle logs out the sessions no scrape used for longer than the idle timeout before now. The sessions are
+// removed from the cache first, the requests logging out are sent without holding the lock.
+func (s *SessionCache) logoutIdle(now time.Time) {
+	var idle []*cachedSession
+	s.mu.Lock()
+	for key, entry := range s.sessions {
+		if entry.users == 0 && now.Sub(entry.lastUsed) > s.idleTimeout {
+			idle = append(idle, entry)
+			delete(s.sessions, key)
+		}
+	}
+	s.mu.Unlock()
+	for _, entry := range idle {
+		entry.logout()
+	}
+}
+
+// Close logs out all cached sessions, it is used on shutdown.
+func (s *SessionCache) Close() {
+	s.mu.Lock()
+	sessions := s.sessions
+	s.sessions = make(map[string]*cachedSession)
+	s.mu.Unlock()
+	for _, entry := range sessions {
+		entry.logout()
+	}
+}
+
+// connect returns a client using the session, logging in first when there is none.
+func (e *cachedSession) connect(ctx context.Context) (*gofish.APIClient, error) {
+	e.mu.Lock()
+	session := e.session
+	e.mu.Unlock()
+	if session == nil {
+		return e.login(ctx)
+	}
+	return gofish.ConnectContext(ctx, gofish.ClientConfig{
+		Endpoint:   e.endpoint,
+		Session:    session,
+		HTTPClient: e.httpClient,
+	})
+}
+
+// login creates a new session unless another scrape did so while waiting for loginMu, and returns a client using it.
+func (e *cachedSession) login(ctx context.Context) (*gofish.APIClient, error) {
+	e.loginMu.Lock()
+	defer e.loginMu.Unlock()
+	e.mu.Lock()
+	session := e.session
+	e.mu.Unlock()
+	if session != nil {
+		return gofish.ConnectContext(ctx, gofish.ClientConfig{
+			Endpoint:   e.endpoint,
+			Session:    session,
+			HTTPClient: e.httpClient,
+		})
+	}
+
+	client, err := gofish.ConnectContext(ctx, gofish.ClientConfig{
+		Endpoint:   e.endpoint,
+		Username:   e.username,
+		Password:   e.password,
+		HTTPClient: e.loginClient,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if session, err := client.GetSession(); err == nil {
+		e.mu.Lock()
+		e.session = session
+		e.mu.Unlock()
+	}
+	// the requests of the scrape go through the client logging in again
+	client.HTTPClient = e.httpClient
+	return client, nil
+}
+
+// renew logs in again after the BMC rejected the session with the token, and returns the token of the new session.
+// A session another request renewed in the meantime is used as is.
+func (e *cachedSession) renew(ctx context.Context, rejectedToken string) (string, error) {
+	e.loginMu.Lock()
+	defer e.loginMu.Unlock()
+	e.mu.Lock()
+	session := e.session
+	e.mu.Unlock()
+	if session != nil && session.Token != rejectedToken {
+		return session.Token, nil
+	}
+
+	e.Log.Info("cached redfish session rejected, logging in again")
+	client, err := gofish.ConnectContext(ctx, gofish.ClientConfig{
+		Endpoint:   e.endpoint,
+		Username:   e.username,
+		Password:   e.password,
+		HTTPClient: e.loginClient,
+	})
+	if err != nil {
+		return "", err
+	}
+	session, err = client.GetSession()
+	if err != nil {
+		return "", err
+	}
+	e.mu.Lock()
+	e.session = session
+	e.mu.Unlock()
+	return session.Token, nil
+}
+
+// token returns the token of the current session, empty when there is none.
+func (e *cachedSession) token() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.session == nil {
+		return ""
+	}
+	return e.session.Token
+}
+
+// logout deletes the session, the entry must not be in use anymore.
+func (e *cachedSession) logout() {
+	e.mu.Lock()
+	session := e.session
+	e.session = nil
+	e.mu.Unlock()
+	if session != nil {
+		deleteSession(e.Log, e.loginClient, e.endpoint, session)
+	}
+}
+
+// sessionTransport is a http.RoundTripper sending the requests of a scrape with the current token of the cached
+// session, and logging in again and retrying once when the BMC rejects the token with a 401.
+type sessionTransport struct {
+	next    http.RoundTripper
+	session *cachedSession
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *sessionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token := req.Header.Get("X-Auth-Token")
+	if token == "" {
+		return t.next.RoundTrip(req)
+	}
+	// another request may have renewed the session the client was created with
+	if current := t.session.token(); current != "" && current != token {
+		req = withToken(req, current)
+		token = current
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || (req.Body != nil && req.GetBody == nil) {
+		return resp, err
+	}
+	renewed, renewErr := t.session.renew(req.Context(), token)
+	if renewErr != nil {
+		t.session.Log.WithError(renewErr).Warn("error logging in again to redfish session")
+		return resp, err
+	}
+	resp.Body.Close()
+	retry := withToken(req, renewed)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return t.next.RoundTrip(retry)
+}
+
+// withToken returns a copy of the request sent with the token.
+func withToken(req *http.Request, token string) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.Header.Set("X-Auth-Token", token)
+	return clone
+}
+
+// deleteSession logs out of the session with its own timeout, the scrape context may be done already.
+func deleteSession(logger *log.Entry, httpClient *http.Client, endpoint string, session *gofish.Session) {
+	ctx, cancel := context.WithTimeout(context.Background(), logoutTimeout)
+	defer cancel()
+
+	// the session ID is the path of the session resource on the endpoint
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint+session.ID, nil)
+	if err != nil {
+		logger.WithError(err).Warn("error logging out of redfish session")
+		return
+	}
+	req.Header.Set("X-Auth-Token", session.Token)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		logger.WithError(err).Warn("error logging out of redfish session")
+		return
+	}
+	resp.Body.Close()
+	logger.Debug("logged out of redfish session")
+}
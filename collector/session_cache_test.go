@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// fakeBMC is a redfish service with sessions, it rejects the tokens of sessions it expired.
+type fakeBMC struct {
+	*httptest.Server
+	mu      sync.Mutex
+	logins  int
+	logouts int
+	tokens  map[string]bool
+}
+
+func newFakeBMC() *fakeBMC {
+	bmc := &fakeBMC{tokens: make(map[string]bool)}
+	bmc.Server = httptest.NewTLSServer(http.HandlerFunc(bmc.serveHTTP))
+	return bmc
+}
+
+func (b *fakeBMC) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case r.URL.Path == "/redfish/v1/":
+		fmt.Fprint(w, `{"@odata.id": "/redfish/v1/", "Links": {"Sessions": {"@odata.id": "/redfish/v1/SessionService/Sessions"}}}`)
+	case r.Method == http.MethodPost && r.URL.Path == "/redfish/v1/SessionService/Sessions":
+		b.logins++
+		token := fmt.Sprintf("token-%d", b.logins)
+		b.tokens[token] = true
+		w.Header().Set("X-Auth-Token", token)
+		w.Header().Set("Location", fmt.Sprintf("/redfish/v1/SessionService/Sessions/%d", b.logins))
+		w.WriteHeader(http.StatusCreated)
+	case !b.tokens[r.Header.Get("X-Auth-Token")]:
+		w.WriteHeader(http.StatusUnauthorized)
+	case r.Method == http.MethodDelete:
+		b.logouts++
+		delete(b.tokens, r.Header.Get("X-Auth-Token"))
+	default:
+		fmt.Fprint(w, `{"@odata.id": "/redfish/v1/Chassis", "Members": []}`)
+	}
+}
+
+// expire invalidates all sessions as a BMC restart does.
+func (b *fakeBMC) expire() {
+	b.mu.Lock()
+	b.tokens = make(map[string]bool)
+	b.mu.Unlock()
+}
+
+func (b *fakeBMC) counts() (int, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.logins, b.logouts
+}
+
+func (b *fakeBMC) host() string {
+	return strings.TrimPrefix(b.URL, "https://")
+}
+
+func testClientOptions() *ClientOptions {
+	return &ClientOptions{TLSConfig: &tls.Config{InsecureSkipVerify: true}}
+}
+
+func TestSessionCacheReuse(t *testing.T) {
+	bmc := newFakeBMC()
+	defer bmc.Close()
+	sessions := NewSessionCache(time.Minute, log.WithField("test", t.Name()))
+
+	for i := 0; i < 3; i++ {
+		client, err := sessions.Acquire(context.Background(), bmc.host(), "admin", "secret", testClientOptions())
+		if err != nil {
+			t.Fatalf("Acquire() = %s", err)
+		}
+		sessions.Release(bmc.host(), client)
+	}
+	if logins, logouts := bmc.counts(); logins != 1 || logouts != 0 {
+		t.Errorf("logins, logouts = %d, %d, want 1, 0", logins, logouts)
+	}
+
+	options := testClientOptions()
+	options.Retry = RetryPolicy{MaxRetries: 1}
+	client, err := sessions.Acquire(context.Background(), bmc.host(), "admin", "secret", options)
+	if err != nil {
+		t.Fatalf("Acquire() = %s", err)
+	}
+	sessions.Release(bmc.host(), client)
+	if logins, _ := bmc.counts(); logins != 2 {
+		t.Errorf("logins with other client options = %d, want 2", logins)
+	}
+
+	sessions.Close()
+	if _, logouts := bmc.counts(); logouts != 2 {
+		t.Errorf("logouts after Close() = %d, want 2", logouts)
+	}
+}
+
+func TestSessionCacheRelogin(t *testing.T) {
+	bmc := newFakeBMC()
+	defer bmc.Close()
+	sessions := NewSessionCache(time.Minute, log.WithField("test", t.Name()))
+
+	client, err := sessions.Acquire(context.Background(), bmc.host(), "admin", "secret", testClientOptions())
+	if err != nil {
+		t.Fatalf("Acquire() = %s", err)
+	}
+	defer sessions.Release(bmc.host(), client)
+	bmc.expire()
+
+	resp, err := client.Get("/redfish/v1/Chassis")
+	if err != nil {
+		t.Fatalf("Get() after the session expired = %s", err)
+	}
+	resp.Body.Close()
+	if logins, _ := bmc.counts(); logins != 2 {
+		t.Errorf("logins = %d, want 2", logins)
+	}
+
+	// the client still holds the rejected token, the new one is used without logging in again
+	resp, err = client.Get("/redfish/v1/Chassis")
+	if err != nil {
+		t.Fatalf("Get() = %s", err)
+	}
+	resp.Body.Close()
+	if logins, _ := bmc.counts(); logins != 2 {
+		t.Errorf("logins = %d, want 2", logins)
+	}
+}
+
+func TestSessionCacheIdle(t *testing.T) {
+	bmc := newFakeBMC()
+	defer bmc.Close()
+	sessions := NewSessionCache(time.Minute, log.WithField("test", t.Name()))
+
+	client, err := sessions.Acquire(context.Background(), bmc.host(), "admin", "secret", testClientOptions())
+	if err != nil {
+		t.Fatalf("Acquire() = %s", err)
+	}
+	sessions.logoutIdle(time.Now().Add(time.Hour))
+	if _, logouts := bmc.counts(); logouts != 0 {
+		t.Errorf("logouts of a session in use = %d, want 0", logouts)
+	}
+
+	sessions.Release(bmc.host(), client)
+	sessions.logoutIdle(time.Now().Add(time.Second))
+	if _, logouts := bmc.counts(); logouts != 0 {
+		t.Errorf("logouts of a session released a second ago = %d, want 0", logouts)
+	}
+	sessions.logoutIdle(time.Now().Add(time.Hour))
+	if _, logouts := bmc.counts(); logouts != 1 {
+		t.Errorf("logouts of an idle session = %d, want 1", logouts)
+	}
+}
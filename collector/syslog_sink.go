@@ -0,0 +1,207 @@
+package collector
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+)
+
+const (
+	syslogAppName = "redfish_exporter"
+	// DefaultSyslogSDID is the ID of the structured data element holding the fields of the entries, 32473 is the
+	// enterprise number reserved for documentation by RFC 5612.
+	DefaultSyslogSDID = "redfish@32473"
+)
+
+// syslogFacilities maps the facility names to their RFC 5424 codes.
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11, "ntp": 12, "security": 13, "console": 14, "solaris-cron": 15,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// SyslogFacility returns the code of the facility with the name.
+func SyslogFacility(name string) (int, bool) {
+	facility, ok := syslogFacilities[strings.ToLower(name)]
+	return facility, ok
+}
+
+// syslogSeverity maps the severity of a log entry to a syslog severity.
+func syslogSeverity(severity string) int {
+	switch severity {
+	case "Critical":
+		return 2
+	case "Warning":
+		return 4
+	case "OK":
+		return 6
+	}
+	// notice
+	return 5
+}
+
+// SyslogSinkOptions configures a SyslogSink.
+type SyslogSinkOptions struct {
+	// Network is udp, tcp or tls, Address the host:port of the collector.
+	Network   string
+	Address   string
+	TLSConfig *tls.Config
+	Facility  int
+	// SDID is the ID of the structured data element of the messages.
+	SDID string
+	// BatchSize is the most entries written at once, BatchWait how long entries are held back to fill a batch.
+	BatchSize int
+	BatchWait time.Duration
+	// Timeout bounds connecting to the collector and every write.
+	Timeout time.Duration
+	// Retry configures the retries of writes failing, the connection is reestablished before every retry.
+	Retry RetryPolicy
+}
+
+// SyslogSink sends the forwarded log entries as RFC 5424 messages, one per datagram over udp and octet counted over
+// tcp and tls (RFC 5425). The hostname of a message is the target, the fields of the entry are structured data.
+type SyslogSink struct {
+	*sinkWorker
+	options SyslogSinkOptions
+	// conn is only used by the worker
+	conn net.Conn
+}
+
+// NewSyslogSink returns a SyslogSink and starts forwarding the entries sent to it, the connection is established
+// when the first entries are written.
+func NewSyslogSink(options SyslogSinkOptions, logger *log.Entry) *SyslogSink {
+	if options.Timeout == 0 {
+		options.Timeout = defaultSinkTimeout
+	}
+	if options.SDID == "" {
+		options.SDID = DefaultSyslogSDID
+	}
+	s := &SyslogSink{options: options}
+	s.sinkWorker = newSinkWorker("syslog", options.BatchSize, options.BatchWait, s.write, logger)
+	return s
+}
+
+// Close implements LogSink.
+func (s *SyslogSink) Close() {
+	s.sinkWorker.Close()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// write sends a batch of entries, the entries already written are not sent again when a retry is needed.
+func (s *SyslogSink) write(batch []ForwardedLogEntry) {
+	written := 0
+	err := s.retry(s.options.Retry, func() (bool, error) {
+		for written < len(batch) {
+			if err := s.writeMessage(s.format(&batch[written])); err != nil {
+				return true, err
+			}
+			written++
+		}
+		return false, nil
+	})
+	if written > 0 {
+		s.record(batch[:written], nil)
+	}
+	if err != nil {
+		s.record(batch[written:], err)
+	}
+}
+
+func (s *SyslogSink) writeMessage(message string) error {
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	if s.options.Network != "udp" {
+		message = fmt.Sprintf("%d %s", len(message), message)
+	}
+	err := s.conn.SetWriteDeadline(time.Now().Add(s.options.Timeout))
+	if err == nil {
+		_, err = s.conn.Write([]byte(message))
+	}
+	if err != nil {
+		// the next write reconnects
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+func (s *SyslogSink) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: s.options.Timeout}
+	if s.options.Network == "tls" {
+		return tls.DialWithDialer(dialer, "tcp", s.options.Address, s.options.TLSConfig)
+	}
+	return dialer.Dial(s.options.Network, s.options.Address)
+}
+
+// format returns the RFC 5424 message of the entry, the MSGID is the key of its message ID.
+func (s *SyslogSink) format(entry *ForwardedLogEntry) string {
+	msgID := "-"
+	if _, _, _, key, ok := parseMessageID(entry.MessageID); ok {
+		msgID = syslogHeaderField(key, 32)
+	}
+
+	var sd strings.Builder
+	sd.WriteString("[")
+	sd.WriteString(s.options.SDID)
+	params := [][2]string{
+		{"target", entry.Target},
+		{entry.Subsystem + "_id", entry.ResourceID},
+		{"log_service", entry.LogService},
+		{"log_service_id", entry.LogServiceID},
+		{"entry_id", entry.EntryID},
+		{"message_id", entry.MessageID},
+		{"severity", entry.Severity},
+		{"resolution", entry.Resolution},
+	}
+	for _, param := range params {
+		if param[1] == "" {
+			continue
+		}
+		fmt.Fprintf(&sd, ` %s="%s"`, param[0], syslogParamEscaper.Replace(param[1]))
+	}
+	sd.WriteString("]")
+
+	message := fmt.Sprintf("<%d>1 %s %s %s - %s %s",
+		s.options.Facility*8+syslogSeverity(entry.Severity),
+		entry.Created.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderField(entry.Target, 255),
+		syslogAppName,
+		msgID,
+		sd.String(),
+	)
+	if entry.Message != "" {
+		message += " " + entry.Message
+	}
+	return message
+}
+
+// syslogParamEscaper escapes the characters RFC 5424 reserves in structured data parameter values.
+var syslogParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// syslogHeaderField returns value as a header field of at most maxLen printable ascii characters, - when empty.
+func syslogHeaderField(value string, maxLen int) string {
+	field := strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(field) > maxLen {
+		field = field[:maxLen]
+	}
+	if field == "" {
+		return "-"
+	}
+	return field
+}
@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+)
+
+func TestSyslogSinkFormat(t *testing.T) {
+	created := time.Date(2024, 1, 1, 12, 0, 0, 500000000, time.FixedZone("CET", 3600))
+	tests := []struct {
+		name  string
+		entry ForwardedLogEntry
+		want  string
+	}{
+		{
+			name:  "fields",
+			entry: ForwardedLogEntry{Target: "10.0.0.1", Subsystem: "system", ResourceID: "1", LogService: "SEL", LogServiceID: "Sel", EntryID: "7", Severity: "Critical", MessageID: "Oem.1.0.FanFailed", Message: "Fan 1 failed.", Created: created},
+			want:  `<26>1 2024-01-01T11:00:00.500000Z 10.0.0.1 redfish_exporter - FanFailed [redfish@32473 target="10.0.0.1" system_id="1" log_service="SEL" log_service_id="Sel" entry_id="7" message_id="Oem.1.0.FanFailed" severity="Critical"] Fan 1 failed.`,
+		},
+		{
+			name:  "empty fields",
+			entry: ForwardedLogEntry{Subsystem: "manager", Created: created},
+			want:  `<29>1 2024-01-01T11:00:00.500000Z - redfish_exporter - - [redfish@32473]`,
+		},
+		{
+			name:  "param escaping",
+			entry: ForwardedLogEntry{Target: "bmc", Subsystem: "chassis", Resolution: `set "A\B" [x]`, Created: created},
+			want:  `<29>1 2024-01-01T11:00:00.500000Z bmc redfish_exporter - - [redfish@32473 target="bmc" resolution="set \"A\\B\" [x\]"]`,
+		},
+		{
+			name:  "header fields",
+			entry: ForwardedLogEntry{Target: "bmc 1\n", Subsystem: "chassis", MessageID: "Base.1.0.Bad Key", Created: created},
+			want:  `<29>1 2024-01-01T11:00:00.500000Z bmc_1_ redfish_exporter - Bad_Key [redfish@32473 target="bmc 1` + "\n" + `" message_id="Base.1.0.Bad Key"]`,
+		},
+	}
+	s := &SyslogSink{options: SyslogSinkOptions{Facility: 3, SDID: DefaultSyslogSDID}}
+	for _, test := range tests {
+		if got := s.format(&test.entry); got != test.want {
+			t.Errorf("%s: format() =\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSyslogSeverity(t *testing.T) {
+	for severity, want := range map[string]int{"Critical": 2, "Warning": 4, "OK": 6, "": 5, "Informational": 5} {
+		if got := syslogSeverity(severity); got != want {
+			t.Errorf("syslogSeverity(%q) = %d, want %d", severity, got, want)
+		}
+	}
+}
+
+func TestSyslogSinkFraming(t *testing.T) {
+	for network, want := range map[string]string{
+		"udp": "<29>1 message",
+		"tcp": "13 <29>1 message",
+		"tls": "13 <29>1 message",
+	} {
+		client, server := net.Pipe()
+		s := NewSyslogSink(SyslogSinkOptions{Network: network}, log.WithField("test", t.Name()))
+		s.conn = client
+		go func() {
+			s.writeMessage("<29>1 message")
+			client.Close()
+		}()
+		got, _ := ioutil.ReadAll(server)
+		if string(got) != want {
+			t.Errorf("message written over %s = %q, want %q", network, got, want)
+		}
+		s.Close()
+	}
+}
@@ -1,8 +1,8 @@
 package collector
 
 import (
+	"context"
 	"fmt"
-	"sync"
 
 	"github.com/apex/log"
 	"github.com/prometheus/client_golang/prometheus"
@@ -25,16 +25,23 @@ var (
 	SystemEthernetInterfaceLabelNames = []string{"hostname", "resource", "ethernet_interface", "ethernet_interface_id", "ethernet_interface_speed"}
 	SystemPCIeFunctionLabelNames      = []string{"hostname", "resource", "pcie_function_name", "pcie_function_id", "pci_function_deviceclass", "pci_function_type"}
 
-	SystemLogServiceLabelNames = []string{"system_id", "log_service", "log_service_id", "log_service_enabled", "log_service_overwrite_policy"}
-	SystemLogEntryLabelNames   = []string{"system_id", "log_service", "log_service_id", "log_entry", "log_entry_id", "log_entry_code", "log_entry_type", "log_entry_message_id", "log_entry_sensor_number", "log_entry_sensor_type"}
+	SystemLogServiceLabelNames    = []string{"system_id", "log_service", "log_service_id", "log_service_enabled", "log_service_overwrite_policy"}
+	SystemLogEntryCountLabelNames = []string{"system_id", "log_service", "log_service_id", "severity"}
+	SystemLogEntryTotalLabelNames = []string{"system_id", "log_service", "log_service_id", "severity", "message_id"}
+	SystemLogEntryLabelNames      = []string{"system_id", "log_service", "log_service_id", "log_entry", "log_entry_id", "log_entry_code", "log_entry_type", "log_entry_message_id", "log_entry_sensor_number", "log_entry_sensor_type", "log_entry_message"}
 
 	systemMetrics = createSystemMetricMap()
 )
 
 // SystemCollector implements the prometheus.Collector.
 type SystemCollector struct {
+	ctx           context.Context
 	redfishClient *gofish.APIClient
+	pool          *WorkerPool
+	logs          *TargetLogs
 	metrics       map[string]Metric
+	options       *ScrapeOptions
+	scrapeErrors  *ScrapeErrors
 	prometheus.Collector
 	collectorScrapeStatus *prometheus.GaugeVec
 	Log                   *log.Entry
@@ -94,16 +101,24 @@ func createSystemMetricMap() map[string]Metric {
 
 	addToMetricMap(systemMetrics, SystemSubsystem, "log_service_state", fmt.Sprintf("system log service state,%s", CommonStateHelp), SystemLogServiceLabelNames)
 	addToMetricMap(systemMetrics, SystemSubsystem, "log_service_health_state", fmt.Sprintf("system log service health state,%s", CommonHealthHelp), SystemLogServiceLabelNames)
+	addToMetricMap(systemMetrics, SystemSubsystem, "log_entries", "system log entries by log service and severity", SystemLogEntryCountLabelNames)
+	addToMetricMap(systemMetrics, SystemSubsystem, "log_entry_newest_timestamp_seconds", "system creation time of the newest log entry by log service and severity, in seconds since the epoch", SystemLogEntryCountLabelNames)
+	addToMetricMap(systemMetrics, SystemSubsystem, "log_entries_total", "system log entries seen by log service, severity and message ID when log entries are fetched incrementally", SystemLogEntryTotalLabelNames)
 	addToMetricMap(systemMetrics, SystemSubsystem, "log_entry_severity_state", fmt.Sprintf("system log entry severity state,%s", CommonSeverityHelp), SystemLogEntryLabelNames)
 
 	return systemMetrics
 }
 
 // NewSystemCollector returns a collector that collecting memory statistics
-func NewSystemCollector(redfishClient *gofish.APIClient, logger *log.Entry) *SystemCollector {
+func NewSystemCollector(ctx context.Context, redfishClient *gofish.APIClient, pool *WorkerPool, logs *TargetLogs, options *ScrapeOptions, scrapeErrors *ScrapeErrors, logger *log.Entry) *SystemCollector {
 	return &SystemCollector{
+		ctx:           ctx,
 		redfishClient: redfishClient,
+		pool:          pool,
+		logs:          logs,
 		metrics:       systemMetrics,
+		options:       options,
+		scrapeErrors:  scrapeErrors,
 		Log: logger.WithFields(log.Fields{
 			"collector": "SystemCollector",
 		}),
@@ -111,7 +126,7 @@ func NewSystemCollector(redfishClient *gofish.APIClient, logger *log.Entry) *Sys
 			prometheus.GaugeOpts{
 				Namespace: namespace,
 				Name:      "collector_scrape_status",
-				Help:      "collector_scrape_status",
+				Help:      "collector scrape status,1(Success),0(Failure) if the collector could not list its resources",
 			},
 			[]string{"collector"},
 		),
@@ -131,12 +146,21 @@ func (s *SystemCollector) Collect(ch chan<- prometheus.Metric) {
 	collectorLogContext := s.Log
 	//get service
 	service := s.redfishClient.Service
+	tasks := s.pool.NewTaskGroup(s.ctx)
 
 	// get a list of systems from service
+	listed := false
 	if systems, err := service.Systems(); err != nil {
 		collectorLogContext.WithField("operation", "service.Systems()").WithError(err).Error("error getting systems from service")
+		s.scrapeErrors.add("system", "service.Systems()")
 	} else {
+		listed = true
 		for _, system := range systems {
+			if s.ctx.Err() != nil {
+				collectorLogContext.WithError(s.ctx.Err()).Warn("scrape deadline reached, skipping remaining systems")
+				break
+			}
+			system := system
 			systemLogContext := collectorLogContext.WithField("System", system.ID)
 			systemLogContext.Info("collector scrape started")
 			// overall system metrics
@@ -177,220 +201,202 @@ func (s *SystemCollector) Collect(ch chan<- prometheus.Metric) {
 			if systemTotalMemoryHealthStateValue, ok := parseCommonStatusHealth(systemTotalMemoryHealthState); ok {
 				ch <- prometheus.MustNewConstMetric(s.metrics["system_total_memory_health_state"].desc, prometheus.GaugeValue, systemTotalMemoryHealthStateValue, systemLabelValues...)
 			}
-			
-			// get system OdataID
-			//systemOdataID := system.ODataID
-
-			wg1 := &sync.WaitGroup{}
-			wg2 := &sync.WaitGroup{}
-			wg3 := &sync.WaitGroup{}
-			wg4 := &sync.WaitGroup{}
-			wg5 := &sync.WaitGroup{}
-			wg6 := &sync.WaitGroup{}
-			wg7 := &sync.WaitGroup{}
-			wg8 := &sync.WaitGroup{}
-			wg9 := &sync.WaitGroup{}
-			wg10 := &sync.WaitGroup{}
 
 			// process memory metrics
-			// construct memory Link
-			//memoriesLink := fmt.Sprintf("%sMemory/", systemOdataID)
-
-			//if memories, err := redfish.ListReferencedMemorys(s.redfishClient, memoriesLink); err != nil {
-			memories, err := system.Memory()
-			if err != nil {
-				systemLogContext.WithField("operation", "system.Memory()").WithError(err).Error("error getting memory data from system")
-			} else if memories == nil {
-				systemLogContext.WithField("operation", "system.Memory()").Info("no memory data found")
-			} else {
-				wg1.Add(len(memories))
-
-				for _, memory := range memories {
-					go parseMemory(ch, systemHostName, memory, wg1)
-				}
+			if s.options.resourceEnabled("system", "memory") {
+				tasks.Go(func() {
+					memories, err := system.Memory()
+					if err != nil {
+						systemLogContext.WithField("operation", "system.Memory()").WithError(err).Error("error getting memory data from system")
+						s.scrapeErrors.add("system", "system.Memory()")
+					} else if memories == nil {
+						systemLogContext.WithField("operation", "system.Memory()").Info("no memory data found")
+					} else {
+						for _, memory := range memories {
+							parseMemory(ch, systemHostName, memory)
+						}
+					}
+				})
 			}
 
 			// process processor metrics
-
-			//processorsLink := fmt.Sprintf("%sProcessors/", systemOdataID)
-
-			//if processors, err := redfish.ListReferencedProcessors(s.redfishClient, processorsLink); err != nil {
-			processors, err := system.Processors()
-			if err != nil {
-				systemLogContext.WithField("operation", "system.Processors()").WithError(err).Error("error getting processor data from system")
-			} else if processors == nil {
-				systemLogContext.WithField("operation", "system.Processors()").Info("no processor data found")
-			} else {
-				wg2.Add(len(processors))
-
-				for _, processor := range processors {
-					go parseProcessor(ch, systemHostName, processor, wg2)
-
-				}
+			if s.options.resourceEnabled("system", "processors") {
+				tasks.Go(func() {
+					processors, err := system.Processors()
+					if err != nil {
+						systemLogContext.WithField("operation", "system.Processors()").WithError(err).Error("error getting processor data from system")
+						s.scrapeErrors.add("system", "system.Processors()")
+					} else if processors == nil {
+						systemLogContext.WithField("operation", "system.Processors()").Info("no processor data found")
+					} else {
+						for _, processor := range processors {
+							parseProcessor(ch, systemHostName, processor)
+						}
+					}
+				})
 			}
 
 			//process storage
-			//storagesLink := fmt.Sprintf("%sStorage/", systemOdataID)
-
-			//if storages, err := redfish.ListReferencedStorages(s.redfishClient, storagesLink); err != nil {
-			storages, err := system.Storage()
-			if err != nil {
-				systemLogContext.WithField("operation", "system.Storage()").WithError(err).Error("error getting storage data from system")
-			} else if storages == nil {
-				systemLogContext.WithField("operation", "system.Storage()").Info("no storage data found")
-			} else {
-				for _, storage := range storages {
-					if volumes, err := storage.Volumes(); err != nil {
-						systemLogContext.WithField("operation", "system.Volumes()").WithError(err).Error("error getting storage data from system")
+			if s.options.resourceEnabled("system", "storage") {
+				tasks.Go(func() {
+					storages, err := system.Storage()
+					if err != nil {
+						systemLogContext.WithField("operation", "system.Storage()").WithError(err).Error("error getting storage data from system")
+						s.scrapeErrors.add("system", "system.Storage()")
+					} else if storages == nil {
+						systemLogContext.WithField("operation", "system.Storage()").Info("no storage data found")
 					} else {
-						wg3.Add(len(volumes))
-
-						for _, volume := range volumes {
-							go parseVolume(ch, systemHostName, volume, wg3)
+						for _, storage := range storages {
+							storage := storage
+							tasks.Go(func() {
+								if volumes, err := storage.Volumes(); err != nil {
+									systemLogContext.WithField("operation", "system.Volumes()").WithError(err).Error("error getting storage data from system")
+									s.scrapeErrors.add("system", "system.Volumes()")
+								} else {
+									for _, volume := range volumes {
+										parseVolume(ch, systemHostName, volume)
+									}
+								}
+							})
+							tasks.Go(func() {
+								drives, err := storage.Drives()
+								if err != nil {
+									systemLogContext.WithField("operation", "system.Drives()").WithError(err).Error("error getting drive data from system")
+									s.scrapeErrors.add("system", "system.Drives()")
+								} else if drives == nil {
+									systemLogContext.WithFields(log.Fields{"operation": "system.Drives()", "storage": storage.ID}).Info("no drive data found")
+								} else {
+									for _, drive := range drives {
+										parseDrive(ch, systemHostName, drive)
+									}
+								}
+							})
 						}
 					}
+				})
+			}
 
-					drives, err := storage.Drives()
+			//process pci devices
+			if s.options.resourceEnabled("system", "pcie_devices") {
+				tasks.Go(func() {
+					pcieDevices, err := system.PCIeDevices()
 					if err != nil {
-						systemLogContext.WithField("operation", "system.Drives()").WithError(err).Error("error getting drive data from system")
-					} else if drives == nil {
-						systemLogContext.WithFields(log.Fields{"operation": "system.Drives()", "storage": storage.ID}).Info("no drive data found")
+						systemLogContext.WithField("operation", "system.PCIeDevices()").WithError(err).Error("error getting PCI-E device data from system")
+						s.scrapeErrors.add("system", "system.PCIeDevices()")
+					} else if pcieDevices == nil {
+						systemLogContext.WithField("operation", "system.PCIeDevices()").Info("no PCI-E device data found")
 					} else {
-						wg4.Add(len(drives))
-						for _, drive := range drives {
-							go parseDrive(ch, systemHostName, drive, wg4)
+						for _, pcieDevice := range pcieDevices {
+							parsePcieDevice(ch, systemHostName, pcieDevice)
 						}
 					}
-
-					//					if storagecontrollers, err := storage.StorageControllers(); err != nil {
-					//						log.Infof("Errors Getting storagecontrollers from system storage : %s", err)
-					//					} else {
-					//
-					//						for _, controller := range storagecontrollers {
-					//
-					//							controllerODataIDslice := strings.Split(controller.ODataID, "/")
-					//							controllerName := controllerODataIDslice[len(controllerODataIDslice)-1]
-					//							controllerState := controller.Status.State
-					//							controllerHealthState := controller.Status.Health
-					//							controllerLabelValues := []string{ "storage_controller", controllerName, systemHostName)
-					//							if controllerStateValue,ok := parseCommonStatusState(controllerState); ok {
-					//								ch <- prometheus.MustNewConstMetric(s.metrics["system_storage_controller_state"].desc, prometheus.GaugeValue, controllerStateValue, //controllerLabelValues...)
-					//
-					//							}
-					//							if controllerHealthStateValue,ok := parseCommonStatusHealth(controllerHealthState); ok {
-					//								ch <- prometheus.MustNewConstMetric(s.metrics["system_storage_controller_health_state"].desc, prometheus.GaugeValue, controllerHealthStateValue, //controllerLabelValues...)
-					//
-					//							}
-					//
-					//						}
-					//
-					//					}
-
-				}
-			}
-			//process pci devices
-			//pciDevicesLink := fmt.Sprintf("%sPcidevice/", systemOdataID)
-			pcieDevices, err := system.PCIeDevices()
-			if err != nil {
-				systemLogContext.WithField("operation", "system.PCIeDevices()").WithError(err).Error("error getting PCI-E device data from system")
-			} else if pcieDevices == nil {
-				systemLogContext.WithField("operation", "system.PCIeDevices()").Info("no PCI-E device data found")
-			} else {
-				wg5.Add(len(pcieDevices))
-				for _, pcieDevice := range pcieDevices {
-					go parsePcieDevice(ch, systemHostName, pcieDevice, wg5)
-				}
+				})
 			}
 
 			//process networkinterfaces
-			networkInterfaces, err := system.NetworkInterfaces()
-			if err != nil {
-				systemLogContext.WithField("operation", "system.NetworkInterfaces()").WithError(err).Error("error getting network interface data from system")
-			} else if networkInterfaces == nil {
-				systemLogContext.WithField("operation", "system.NetworkInterfaces()").Info("no network interface data found")
-			} else {
-				wg6.Add(len(networkInterfaces))
-				for _, networkInterface := range networkInterfaces {
-					go parseNetworkInterface(ch, systemHostName, networkInterface, wg6)
-				}
+			if s.options.resourceEnabled("system", "network_interfaces") {
+				tasks.Go(func() {
+					networkInterfaces, err := system.NetworkInterfaces()
+					if err != nil {
+						systemLogContext.WithField("operation", "system.NetworkInterfaces()").WithError(err).Error("error getting network interface data from system")
+						s.scrapeErrors.add("system", "system.NetworkInterfaces()")
+					} else if networkInterfaces == nil {
+						systemLogContext.WithField("operation", "system.NetworkInterfaces()").Info("no network interface data found")
+					} else {
+						for _, networkInterface := range networkInterfaces {
+							parseNetworkInterface(ch, systemHostName, networkInterface)
+						}
+					}
+				})
 			}
 
 			//process ethernetinterfaces
-			ethernetInterfaces, err := system.EthernetInterfaces()
-			if err != nil {
-				systemLogContext.WithField("operation", "system.EthernetInterfaces()").WithError(err).Error("error getting ethernet interface data from system")
-			} else if ethernetInterfaces == nil {
-				systemLogContext.WithField("operation", "system.PCIeDevices()").Info("no ethernet interface data found")
-			} else {
-				wg7.Add(len(ethernetInterfaces))
-				for _, ethernetInterface := range ethernetInterfaces {
-					go parseEthernetInterface(ch, systemHostName, ethernetInterface, wg7)
-				}
+			if s.options.resourceEnabled("system", "ethernet_interfaces") {
+				tasks.Go(func() {
+					ethernetInterfaces, err := system.EthernetInterfaces()
+					if err != nil {
+						systemLogContext.WithField("operation", "system.EthernetInterfaces()").WithError(err).Error("error getting ethernet interface data from system")
+						s.scrapeErrors.add("system", "system.EthernetInterfaces()")
+					} else if ethernetInterfaces == nil {
+						systemLogContext.WithField("operation", "system.EthernetInterfaces()").Info("no ethernet interface data found")
+					} else {
+						for _, ethernetInterface := range ethernetInterfaces {
+							parseEthernetInterface(ch, systemHostName, ethernetInterface)
+						}
+					}
+				})
 			}
 
 			//process simple storage
-			simpleStorages, err := system.SimpleStorages()
-			if err != nil {
-				systemLogContext.WithField("operation", "system.SimpleStorages()").WithError(err).Error("error getting simple storage data from system")
-			} else if simpleStorages == nil {
-				systemLogContext.WithField("operation", "system.SimpleStorages()").Info("no simple storage data found")
-			} else {
-				for _, simpleStorage := range simpleStorages {
-					devices := simpleStorage.Devices
-					wg8.Add(len(devices))
-					for _, device := range devices {
-						go parseDevice(ch, systemHostName, device, wg8)
+			if s.options.resourceEnabled("system", "simple_storage") {
+				tasks.Go(func() {
+					simpleStorages, err := system.SimpleStorages()
+					if err != nil {
+						systemLogContext.WithField("operation", "system.SimpleStorages()").WithError(err).Error("error getting simple storage data from system")
+						s.scrapeErrors.add("system", "system.SimpleStorages()")
+					} else if simpleStorages == nil {
+						systemLogContext.WithField("operation", "system.SimpleStorages()").Info("no simple storage data found")
+					} else {
+						for _, simpleStorage := range simpleStorages {
+							for _, device := range simpleStorage.Devices {
+								parseDevice(ch, systemHostName, device)
+							}
+						}
 					}
-				}
+				})
 			}
+
 			//process pci functions
-			pcieFunctions, err := system.PCIeFunctions()
-			if err != nil {
-				systemLogContext.WithField("operation", "system.PCIeFunctions()").WithError(err).Error("error getting PCI-E device function data from system")
-			} else if pcieFunctions == nil {
-				systemLogContext.WithField("operation", "system.PCIeFunctions()").Info("no PCI-E device function data found")
-			} else {
-				wg9.Add(len(pcieFunctions))
-				for _, pcieFunction := range pcieFunctions {
-					go parsePcieFunction(ch, systemHostName, pcieFunction, wg9)
-				}
+			if s.options.resourceEnabled("system", "pcie_functions") {
+				tasks.Go(func() {
+					pcieFunctions, err := system.PCIeFunctions()
+					if err != nil {
+						systemLogContext.WithField("operation", "system.PCIeFunctions()").WithError(err).Error("error getting PCI-E device function data from system")
+						s.scrapeErrors.add("system", "system.PCIeFunctions()")
+					} else if pcieFunctions == nil {
+						systemLogContext.WithField("operation", "system.PCIeFunctions()").Info("no PCI-E device function data found")
+					} else {
+						for _, pcieFunction := range pcieFunctions {
+							parsePcieFunction(ch, systemHostName, pcieFunction)
+						}
+					}
+				})
 			}
 
 			// process log services
-			logServices, err := system.LogServices()
-			if err != nil {
-				systemLogContext.WithField("operation", "system.LogServices()").WithError(err).Error("error getting log services from system")
-			} else if logServices == nil {
-				systemLogContext.WithField("operation", "system.LogServices()").Info("no log services found")
-			} else {
-				wg10.Add(len(logServices))
-
-				for _, logService := range logServices {
-					if err = parseLogService(ch, systemMetrics, SystemSubsystem, SystemID, logService, wg10); err != nil {
-						systemLogContext.WithField("operation", "system.LogServices()").WithError(err).Error("error getting log entries from log service")
+			if s.options.resourceEnabled("system", "log_services") {
+				tasks.Go(func() {
+					logServices, err := system.LogServices()
+					if err != nil {
+						systemLogContext.WithField("operation", "system.LogServices()").WithError(err).Error("error getting log services from system")
+						s.scrapeErrors.add("system", "system.LogServices()")
+					} else if logServices == nil {
+						systemLogContext.WithField("operation", "system.LogServices()").Info("no log services found")
+					} else {
+						for _, logService := range logServices {
+							logService := logService
+							tasks.Go(func() {
+								if err := parseLogService(ch, systemMetrics, SystemSubsystem, SystemID, logService, s.options.logEntryOptions(), s.logs); err != nil {
+									systemLogContext.WithField("operation", "system.LogServices()").WithError(err).Error("error getting log entries from log service")
+									s.scrapeErrors.add("system", "system.LogServices()")
+								}
+							})
+						}
 					}
-				}
+				})
 			}
-
-			wg1.Wait()
-			wg2.Wait()
-			wg3.Wait()
-			wg4.Wait()
-			wg5.Wait()
-			wg6.Wait()
-			wg7.Wait()
-			wg8.Wait()
-			wg9.Wait()
-			wg10.Wait()
-
-			systemLogContext.Info("collector scrape completed")
 		}
-		s.collectorScrapeStatus.WithLabelValues("system").Set(float64(1))
 	}
+
+	// every metric has to be sent before Collect returns
+	tasks.Wait()
+	collectorLogContext.Info("collector scrape completed")
+
+	s.collectorScrapeStatus.WithLabelValues("system").Set(boolToFloat64(listed))
+	s.collectorScrapeStatus.Collect(ch)
 }
 
-func parseMemory(ch chan<- prometheus.Metric, systemHostName string, memory *redfish.Memory, wg *sync.WaitGroup) {
-	defer wg.Done()
+func parseMemory(ch chan<- prometheus.Metric, systemHostName string, memory *redfish.Memory) {
 	memoryName := memory.Name
 	memoryID := memory.ID
 	//memoryDeviceLocator := memory.DeviceLocator
@@ -409,8 +415,7 @@ func parseMemory(ch chan<- prometheus.Metric, systemHostName string, memory *red
 
 }
 
-func parseProcessor(ch chan<- prometheus.Metric, systemHostName string, processor *redfish.Processor, wg *sync.WaitGroup) {
-	defer wg.Done()
+func parseProcessor(ch chan<- prometheus.Metric, systemHostName string, processor *redfish.Processor) {
 	processorName := processor.Name
 	processorID := processor.ID
 	processorTotalCores := processor.TotalCores
@@ -429,8 +434,7 @@ func parseProcessor(ch chan<- prometheus.Metric, systemHostName string, processo
 	ch <- prometheus.MustNewConstMetric(systemMetrics["system_processor_total_threads"].desc, prometheus.GaugeValue, float64(processorTotalThreads), systemProcessorLabelValues...)
 	ch <- prometheus.MustNewConstMetric(systemMetrics["system_processor_total_cores"].desc, prometheus.GaugeValue, float64(processorTotalCores), systemProcessorLabelValues...)
 }
-func parseVolume(ch chan<- prometheus.Metric, systemHostName string, volume *redfish.Volume, wg *sync.WaitGroup) {
-	defer wg.Done()
+func parseVolume(ch chan<- prometheus.Metric, systemHostName string, volume *redfish.Volume) {
 	volumeName := volume.Name
 	volumeID := volume.ID
 	volumeCapacityBytes := volume.CapacityBytes
@@ -445,8 +449,7 @@ func parseVolume(ch chan<- prometheus.Metric, systemHostName string, volume *red
 	}
 	ch <- prometheus.MustNewConstMetric(systemMetrics["system_storage_volume_capacity"].desc, prometheus.GaugeValue, float64(volumeCapacityBytes), systemVolumeLabelValues...)
 }
-func parseDevice(ch chan<- prometheus.Metric, systemHostName string, device redfish.Device, wg *sync.WaitGroup) {
-	defer wg.Done()
+func parseDevice(ch chan<- prometheus.Metric, systemHostName string, device redfish.Device) {
 	deviceName := device.Name
 	deviceState := device.Status.State
 	deviceHealthState := device.Status.Health
@@ -458,8 +461,7 @@ func parseDevice(ch chan<- prometheus.Metric, systemHostName string, device redf
 		ch <- prometheus.MustNewConstMetric(systemMetrics["system_simple_storage_device_health_state"].desc, prometheus.GaugeValue, deviceHealthStateValue, systemDeviceLabelValues...)
 	}
 }
-func parseDrive(ch chan<- prometheus.Metric, systemHostName string, drive *redfish.Drive, wg *sync.WaitGroup) {
-	defer wg.Done()
+func parseDrive(ch chan<- prometheus.Metric, systemHostName string, drive *redfish.Drive) {
 	driveName := drive.Name
 	driveID := drive.ID
 	driveCapacityBytes := drive.CapacityBytes
@@ -475,8 +477,7 @@ func parseDrive(ch chan<- prometheus.Metric, systemHostName string, drive *redfi
 	ch <- prometheus.MustNewConstMetric(systemMetrics["system_storage_drive_capacity"].desc, prometheus.GaugeValue, float64(driveCapacityBytes), systemdriveLabelValues...)
 }
 
-func parsePcieDevice(ch chan<- prometheus.Metric, systemHostName string, pcieDevice *redfish.PCIeDevice, wg *sync.WaitGroup) {
-	defer wg.Done()
+func parsePcieDevice(ch chan<- prometheus.Metric, systemHostName string, pcieDevice *redfish.PCIeDevice) {
 	pcieDeviceName := pcieDevice.Name
 	pcieDeviceID := pcieDevice.ID
 	pcieDeviceState := pcieDevice.Status.State
@@ -494,8 +495,7 @@ func parsePcieDevice(ch chan<- prometheus.Metric, systemHostName string, pcieDev
 	}
 }
 
-func parseNetworkInterface(ch chan<- prometheus.Metric, systemHostName string, networkInterface *redfish.NetworkInterface, wg *sync.WaitGroup) {
-	defer wg.Done()
+func parseNetworkInterface(ch chan<- prometheus.Metric, systemHostName string, networkInterface *redfish.NetworkInterface) {
 	networkInterfaceName := networkInterface.Name
 	networkInterfaceID := networkInterface.ID
 	networkInterfaceState := networkInterface.Status.State
@@ -510,8 +510,7 @@ func parseNetworkInterface(ch chan<- prometheus.Metric, systemHostName string, n
 	}
 }
 
-func parseEthernetInterface(ch chan<- prometheus.Metric, systemHostName string, ethernetInterface *redfish.EthernetInterface, wg *sync.WaitGroup) {
-	defer wg.Done()
+func parseEthernetInterface(ch chan<- prometheus.Metric, systemHostName string, ethernetInterface *redfish.EthernetInterface) {
 	//ethernetInterfaceODataIDslice := strings.Split(ethernetInterface.ODataID, "/")
 	//ethernetInterfaceName := ethernetInterfaceODataIDslice[len(ethernetInterfaceODataIDslice)-1]
 	ethernetInterfaceName := ethernetInterface.Name
@@ -535,8 +534,7 @@ func parseEthernetInterface(ch chan<- prometheus.Metric, systemHostName string,
 	ch <- prometheus.MustNewConstMetric(systemMetrics["system_ethernet_interface_link_enabled"].desc, prometheus.GaugeValue, boolToFloat64(ethernetInterfaceEnabled), systemEthernetInterfaceLabelValues...)
 }
 
-func parsePcieFunction(ch chan<- prometheus.Metric, systemHostName string, pcieFunction *redfish.PCIeFunction, wg *sync.WaitGroup) {
-	defer wg.Done()
+func parsePcieFunction(ch chan<- prometheus.Metric, systemHostName string, pcieFunction *redfish.PCIeFunction) {
 	pcieFunctionName := pcieFunction.Name
 	pcieFunctionID := fmt.Sprint(pcieFunction.ID)
 	pciFunctionDeviceclass := fmt.Sprint(pcieFunction.DeviceClass)
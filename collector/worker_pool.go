@@ -0,0 +1,108 @@
+package collector
+
+import (
+	"context"
+	"sync"
+)
+
+// WorkerPool runs the redfish fetches of all scrapes on a fixed number of workers. Tasks are queued per target without
+// bound, so a task can add further tasks without blocking a worker, and the workers take the tasks of the targets with
+// queued tasks in turn, so that a target with many resources does not hold up the scrapes of the others.
+type WorkerPool struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queues map[string][]func()
+	// turns lists the targets with queued tasks, the next task is taken from the first of them.
+	turns []string
+}
+
+// NewWorkerPool starts a WorkerPool with the given number of workers.
+func NewWorkerPool(workers int) *WorkerPool {
+	p := &WorkerPool{queues: make(map[string][]func())}
+	p.cond = sync.NewCond(&p.mu)
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *WorkerPool) submit(target string, task func()) {
+	p.mu.Lock()
+	if len(p.queues[target]) == 0 {
+		p.turns = append(p.turns, target)
+	}
+	p.queues[target] = append(p.queues[target], task)
+	p.mu.Unlock()
+	p.cond.Signal()
+}
+
+// next takes the next task of the target whose turn it is, the target goes to the back of the turns while it has
+// further tasks. The caller must hold p.mu.
+func (p *WorkerPool) next() func() {
+	target := p.turns[0]
+	p.turns = p.turns[1:]
+	queue := p.queues[target]
+	task := queue[0]
+	queue[0] = nil
+	if len(queue) == 1 {
+		delete(p.queues, target)
+	} else {
+		p.queues[target] = queue[1:]
+		p.turns = append(p.turns, target)
+	}
+	return task
+}
+
+func (p *WorkerPool) work() {
+	for {
+		p.mu.Lock()
+		for len(p.turns) == 0 {
+			p.cond.Wait()
+		}
+		task := p.next()
+		p.mu.Unlock()
+		task()
+	}
+}
+
+type poolTargetKey struct{}
+
+// withPoolTarget returns a context whose task groups queue their tasks as tasks of the target.
+func withPoolTarget(ctx context.Context, target string) context.Context {
+	return context.WithValue(ctx, poolTargetKey{}, target)
+}
+
+// TaskGroup tracks the tasks of one collector run, Wait returns once all of them, including the tasks they added,
+// are done. Tasks still queued when ctx is done are skipped.
+type TaskGroup struct {
+	ctx    context.Context
+	pool   *WorkerPool
+	target string
+	wg     sync.WaitGroup
+}
+
+// NewTaskGroup returns an empty TaskGroup running its tasks on the pool, as tasks of the target of ctx.
+func (p *WorkerPool) NewTaskGroup(ctx context.Context) *TaskGroup {
+	target, _ := ctx.Value(poolTargetKey{}).(string)
+	return &TaskGroup{ctx: ctx, pool: p, target: target}
+}
+
+// Go queues the task.
+func (g *TaskGroup) Go(task func()) {
+	g.wg.Add(1)
+	g.pool.submit(g.target, func() {
+		defer g.wg.Done()
+		if g.ctx.Err() != nil {
+			return
+		}
+		task()
+	})
+}
+
+// Wait blocks until all tasks of the group are done.
+func (g *TaskGroup) Wait() {
+	g.wg.Wait()
+}
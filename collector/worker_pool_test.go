@@ -0,0 +1,55 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestWorkerPoolTakesTargetsInTurn(t *testing.T) {
+	pool := NewWorkerPool(1)
+	gate := make(chan struct{})
+	blocker := pool.NewTaskGroup(context.Background())
+	blocker.Go(func() { <-gate })
+
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	record := func(name string) func() {
+		return func() {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+		}
+	}
+	big := pool.NewTaskGroup(withPoolTarget(context.Background(), "big"))
+	small := pool.NewTaskGroup(withPoolTarget(context.Background(), "small"))
+	for _, name := range []string{"big-1", "big-2", "big-3"} {
+		big.Go(record(name))
+	}
+	small.Go(record("small-1"))
+	close(gate)
+	big.Wait()
+	small.Wait()
+	blocker.Wait()
+
+	want := []string{"big-1", "small-1", "big-2", "big-3"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("tasks ran in order %v, want %v", order, want)
+	}
+}
+
+func TestTaskGroupSkipsCancelledTasks(t *testing.T) {
+	pool := NewWorkerPool(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tasks := pool.NewTaskGroup(ctx)
+	ran := false
+	tasks.Go(func() { ran = true })
+	tasks.Wait()
+	if ran {
+		t.Error("task of a cancelled group ran")
+	}
+}
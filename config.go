@@ -1,17 +1,48 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	alog "github.com/apex/log"
+	"github.com/jenningsloy318/redfish_exporter/collector"
 	yaml "gopkg.in/yaml.v2"
 )
 
 type Config struct {
-	Hosts    map[string]HostConfig `yaml:"hosts"`
-	Groups   map[string]HostConfig `yaml:"groups"`
-	Loglevel string                `yaml:"loglevel"`
+	Hosts     map[string]HostConfig   `yaml:"hosts"`
+	HostRules []HostRule              `yaml:"host_rules"`
+	Groups    map[string]HostConfig   `yaml:"groups"`
+	Modules   map[string]ModuleConfig `yaml:"modules"`
+	Polling   PollingConfig           `yaml:"polling"`
+	LogSinks  LogSinksConfig          `yaml:"log_sinks"`
+	Loglevel  string                  `yaml:"loglevel"`
+}
+
+// PollingConfig lists the targets scraped in the background, /redfish serves their latest result from memory.
+type PollingConfig struct {
+	Targets []PollTarget `yaml:"targets"`
+}
+
+// PollTarget is a target polled in the background, it is served for /redfish requests with the same target, group
+// and module parameters.
+type PollTarget struct {
+	Target string `yaml:"target"`
+	Group  string `yaml:"group"`
+	Module string `yaml:"module"`
 }
 
 type SafeConfig struct {
@@ -21,17 +52,607 @@ type SafeConfig struct {
 
 type HostConfig struct {
 	Username string `yaml:"username"`
-	Password string `yaml:"password"`
+	// Password is used as is, ${VAR} references in it are not expanded.
+	Password Secret `yaml:"password"`
+	// PasswordEnv is the name of the environment variable holding the password.
+	PasswordEnv string `yaml:"password_env"`
+	// PasswordFile is read on every config (re)load and its content, without the trailing newline, is used as password.
+	PasswordFile string `yaml:"password_file"`
+	// PasswordCommand is executed on every config (re)load and its stdout is used as password.
+	PasswordCommand []string  `yaml:"password_command"`
+	TLS             TLSConfig `yaml:"tls"`
+	// Timeout replaces the timeout announced by Prometheus for scrapes of the host.
+	Timeout time.Duration `yaml:"timeout"`
+	// PollInterval and PollJitter set how often the host is scraped when it is listed in polling, a random delay of
+	// up to PollJitter is added to every interval so that hosts are not polled all at once.
+	PollInterval time.Duration `yaml:"poll_interval"`
+	PollJitter   time.Duration `yaml:"poll_jitter"`
+	// MaxConcurrentRequests and RequestsPerSecond limit the redfish requests in flight and started per second
+	// for each target, 0 means no limit.
+	MaxConcurrentRequests int                  `yaml:"max_concurrent_requests"`
+	RequestsPerSecond     float64              `yaml:"requests_per_second"`
+	Retry                 RetryConfig          `yaml:"retry"`
+	CircuitBreaker        CircuitBreakerConfig `yaml:"circuit_breaker"`
 }
 
-func (sc *SafeConfig) ReloadConfig(configFile string) error {
+// RetryConfig configures the retries of GET requests failing with a transport error, a 429 or a 5xx.
+type RetryConfig struct {
+	// MaxRetries is the number of retries after the first attempt, 0 disables retries.
+	MaxRetries int `yaml:"max_retries"`
+	// InitialBackoff is doubled after every retry up to MaxBackoff.
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+// CircuitBreakerConfig configures the circuit breaker failing the scrapes of a target fast after repeated failures.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed requests opening the breaker, 0 disables it.
+	FailureThreshold int `yaml:"failure_threshold"`
+	// Cooldown is how long the breaker stays open before a trial request is let through.
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+// ClientOptions returns the settings of the http client talking to the host.
+func (h *HostConfig) ClientOptions() (*collector.ClientOptions, error) {
+	tlsConfig, err := h.TLS.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &collector.ClientOptions{
+		TLSConfig: tlsConfig,
+		Limits: collector.TargetLimits{
+			MaxConcurrentRequests: h.MaxConcurrentRequests,
+			RequestsPerSecond:     h.RequestsPerSecond,
+		},
+		Retry: collector.RetryPolicy{
+			MaxRetries:     h.Retry.MaxRetries,
+			InitialBackoff: h.Retry.InitialBackoff,
+			MaxBackoff:     h.Retry.MaxBackoff,
+		},
+		CircuitBreaker: collector.CircuitBreakerPolicy{
+			FailureThreshold: h.CircuitBreaker.FailureThreshold,
+			Cooldown:         h.CircuitBreaker.Cooldown,
+		},
+	}, nil
+}
+
+// ModuleConfig selects the collectors, timeout and authentication of a scrape, it is chosen with the module
+// parameter of the /redfish endpoint.
+type ModuleConfig struct {
+	// Collectors lists the collectors to run (chassis, system, manager), all of them when empty.
+	Collectors []string `yaml:"collectors"`
+	// Exclude lists the resources to skip, e.g. log_services or system.pcie_functions.
+	Exclude []string `yaml:"exclude"`
+	// Timeout bounds the whole scrape.
+	Timeout time.Duration `yaml:"timeout"`
+	// Auth overrides the credentials and tls settings of the host for this module.
+	Auth *HostConfig `yaml:"auth"`
+	// LogEntries selects the per entry series of the log services.
+	LogEntries LogEntriesConfig `yaml:"log_entries"`
+}
+
+// LogEntriesConfig selects the series exported for every log entry, next to the counts per log service and severity.
+type LogEntriesConfig struct {
+	// Detail enables the series per log entry, they are exported unless it is set to false.
+	Detail *bool `yaml:"detail"`
+	// DetailLimit only exports the newest entries of each log service, 0 exports all of them.
+	DetailLimit int `yaml:"detail_limit"`
+	// DetailMaxAge only exports the entries created within it, 0 exports all of them.
+	DetailMaxAge time.Duration `yaml:"detail_max_age"`
+	// Incremental only fetches the entries added since the previous scrape of the target.
+	Incremental bool `yaml:"incremental"`
+}
+
+// ScrapeOptions returns the collector options of the module.
+func (m *ModuleConfig) ScrapeOptions() *collector.ScrapeOptions {
+	return &collector.ScrapeOptions{
+		Collectors: m.Collectors,
+		Exclude:    m.Exclude,
+		LogEntries: collector.LogEntryOptions{
+			Detail:       m.LogEntries.Detail == nil || *m.LogEntries.Detail,
+			DetailLimit:  m.LogEntries.DetailLimit,
+			DetailMaxAge: m.LogEntries.DetailMaxAge,
+			Incremental:  m.LogEntries.Incremental,
+		},
+	}
+}
+
+// ApplyAuth returns a copy of the HostConfig with the settings of the module auth block applied over it.
+func (m *ModuleConfig) ApplyAuth(hostConfig *HostConfig) *HostConfig {
+	merged := *hostConfig
+	if m.Auth == nil {
+		return &merged
+	}
+	if m.Auth.Username != "" {
+		merged.Username = m.Auth.Username
+	}
+	if m.Auth.Password != "" {
+		merged.Password = m.Auth.Password
+	}
+	if m.Auth.TLS != (TLSConfig{}) {
+		merged.TLS = m.Auth.TLS
+	}
+	return &merged
+}
+
+// LogSinksConfig configures where the new entries of incrementally fetched log services are forwarded to.
+type LogSinksConfig struct {
+	Loki   *LokiSinkConfig   `yaml:"loki"`
+	Syslog *SyslogSinkConfig `yaml:"syslog"`
+}
+
+// LokiSinkConfig configures the forwarding of log entries to the push API of Loki.
+type LokiSinkConfig struct {
+	// URL is the push endpoint, e.g. http://loki:3100/loki/api/v1/push.
+	URL      string `yaml:"url"`
+	TenantID string `yaml:"tenant_id"`
+	// Username and Password enable basic authentication, PasswordEnv names the environment variable holding the
+	// password instead.
+	Username    string    `yaml:"username"`
+	Password    Secret    `yaml:"password"`
+	PasswordEnv string    `yaml:"password_env"`
+	TLS         TLSConfig `yaml:"tls"`
+	// BatchSize is the most entries sent in one push, BatchWait how long entries are held back to fill a batch.
+	BatchSize int           `yaml:"batch_size"`
+	BatchWait time.Duration `yaml:"batch_wait"`
+	Timeout   time.Duration `yaml:"timeout"`
+	// Retry configures the retries of pushes failing with a transport error, a 429 or a 5xx.
+	Retry RetryConfig `yaml:"retry"`
+}
+
+// validate checks the settings and loads the password from the environment when password_env is set.
+func (l *LokiSinkConfig) validate() []error {
+	var errs []error
+	if u, err := url.Parse(l.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("url must be an http or https URL"))
+	}
+	if l.PasswordEnv != "" {
+		password, ok := os.LookupEnv(l.PasswordEnv)
+		switch {
+		case l.Password != "":
+			errs = append(errs, fmt.Errorf("only one of password and password_env can be set"))
+		case !ok:
+			errs = append(errs, fmt.Errorf("password_env: environment variable %s not set", l.PasswordEnv))
+		default:
+			l.Password = Secret(password)
+		}
+	}
+	if _, err := l.TLS.ClientConfig(); err != nil {
+		errs = append(errs, fmt.Errorf("tls: %s", err))
+	}
+	if l.BatchSize < 0 || l.BatchWait < 0 || l.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("batch_size, batch_wait and timeout must not be negative"))
+	}
+	if l.Retry.MaxRetries < 0 || l.Retry.InitialBackoff < 0 || l.Retry.MaxBackoff < 0 {
+		errs = append(errs, fmt.Errorf("retry settings must not be negative"))
+	}
+	return errs
+}
+
+// Options returns the settings of the loki sink.
+func (l *LokiSinkConfig) Options() (collector.LokiSinkOptions, error) {
+	tlsConfig, err := l.TLS.ClientConfig()
+	if err != nil {
+		return collector.LokiSinkOptions{}, err
+	}
+	return collector.LokiSinkOptions{
+		URL:       l.URL,
+		TenantID:  l.TenantID,
+		Username:  l.Username,
+		Password:  string(l.Password),
+		TLSConfig: tlsConfig,
+		BatchSize: l.BatchSize,
+		BatchWait: l.BatchWait,
+		Timeout:   l.Timeout,
+		Retry: collector.RetryPolicy{
+			MaxRetries:     l.Retry.MaxRetries,
+			InitialBackoff: l.Retry.InitialBackoff,
+			MaxBackoff:     l.Retry.MaxBackoff,
+		},
+	}, nil
+}
+
+// structuredDataID matches the IDs of RFC 5424 structured data elements that are not registered with IANA, a name and
+// the private enterprise number of the organisation defining it. They are printable ascii without =, ] or ".
+var structuredDataID = regexp.MustCompile(`^[!-~]+@[0-9]+(\.[0-9]+)*$`)
+
+// SyslogSinkConfig configures the forwarding of log entries as RFC 5424 syslog messages.
+type SyslogSinkConfig struct {
+	// Network is udp (the default), tcp or tls, Address the host:port of the syslog collector.
+	Network string    `yaml:"network"`
+	Address string    `yaml:"address"`
+	TLS     TLSConfig `yaml:"tls"`
+	// Facility is the name of the facility of the messages, daemon by default.
+	Facility string `yaml:"facility"`
+	// StructuredDataID is the ID of the structured data element holding the fields of the entries, name@enterprise.
+	StructuredDataID string `yaml:"structured_data_id"`
+	// BatchSize is the most entries written at once, BatchWait how long entries are held back to fill a batch.
+	BatchSize int           `yaml:"batch_size"`
+	BatchWait time.Duration `yaml:"batch_wait"`
+	Timeout   time.Duration `yaml:"timeout"`
+	// Retry configures the retries of writes failing, the connection is reestablished before every retry.
+	Retry RetryConfig `yaml:"retry"`
+}
+
+func (l *SyslogSinkConfig) validate() []error {
+	var errs []error
+	switch l.Network {
+	case "", "udp", "tcp", "tls":
+	default:
+		errs = append(errs, fmt.Errorf("unknown network %s, must be one of udp, tcp or tls", l.Network))
+	}
+	if _, _, err := net.SplitHostPort(l.Address); err != nil {
+		errs = append(errs, fmt.Errorf("address: %s", err))
+	}
+	if _, err := l.TLS.ClientConfig(); err != nil {
+		errs = append(errs, fmt.Errorf("tls: %s", err))
+	}
+	if _, ok := collector.SyslogFacility(l.Facility); l.Facility != "" && !ok {
+		errs = append(errs, fmt.Errorf("unknown facility %s", l.Facility))
+	}
+	if id := l.StructuredDataID; id != "" && (!structuredDataID.MatchString(id) || strings.ContainsAny(id, `="]`) || strings.Count(id, "@") != 1 || len(id) > 32) {
+		errs = append(errs, fmt.Errorf("structured_data_id must be name@enterprise_number of at most 32 characters, e.g. %s", collector.DefaultSyslogSDID))
+	}
+	if l.BatchSize < 0 || l.BatchWait < 0 || l.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("batch_size, batch_wait and timeout must not be negative"))
+	}
+	if l.Retry.MaxRetries < 0 || l.Retry.InitialBackoff < 0 || l.Retry.MaxBackoff < 0 {
+		errs = append(errs, fmt.Errorf("retry settings must not be negative"))
+	}
+	return errs
+}
+
+// Options returns the settings of the syslog sink.
+func (l *SyslogSinkConfig) Options() (collector.SyslogSinkOptions, error) {
+	tlsConfig, err := l.TLS.ClientConfig()
+	if err != nil {
+		return collector.SyslogSinkOptions{}, err
+	}
+	network := l.Network
+	if network == "" {
+		network = "udp"
+	}
+	facility, ok := collector.SyslogFacility(l.Facility)
+	if !ok {
+		facility, _ = collector.SyslogFacility("daemon")
+	}
+	return collector.SyslogSinkOptions{
+		Network:   network,
+		Address:   l.Address,
+		TLSConfig: tlsConfig,
+		Facility:  facility,
+		SDID:      l.StructuredDataID,
+		BatchSize: l.BatchSize,
+		BatchWait: l.BatchWait,
+		Timeout:   l.Timeout,
+		Retry: collector.RetryPolicy{
+			MaxRetries:     l.Retry.MaxRetries,
+			InitialBackoff: l.Retry.InitialBackoff,
+			MaxBackoff:     l.Retry.MaxBackoff,
+		},
+	}, nil
+}
+
+// Secret is a string that is never echoed back when the configuration is printed or marshalled.
+type Secret string
+
+// MarshalYAML implements yaml.Marshaler.
+func (s Secret) MarshalYAML() (interface{}, error) {
+	if s != "" {
+		return "<secret>", nil
+	}
+	return nil, nil
+}
+
+// String implements fmt.Stringer.
+func (s Secret) String() string {
+	if s != "" {
+		return "<secret>"
+	}
+	return ""
+}
+
+// secretCommandTimeout bounds the run time of a password_command.
+const secretCommandTimeout = 30 * time.Second
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${VAR} references with the value of the environment variable, a plain $ is left untouched
+// so that passwords containing it do not need escaping.
+func expandEnv(value string) (string, error) {
+	var missing []string
+	expanded := envReference.ReplaceAllStringFunc(value, func(ref string) string {
+		name := envReference.FindStringSubmatch(ref)[1]
+		envValue, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return envValue
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable(s) %s not set", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// resolveSecrets expands the environment references of the username and password_file and loads the password from
+// the configured secret source, a plain password is taken literally.
+func (h *HostConfig) resolveSecrets() error {
+	username, err := expandEnv(h.Username)
+	if err != nil {
+		return fmt.Errorf("username: %s", err)
+	}
+	h.Username = username
+
+	sources := 0
+	for _, set := range []bool{h.Password != "", h.PasswordEnv != "", h.PasswordFile != "", len(h.PasswordCommand) > 0} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return fmt.Errorf("only one of password, password_env, password_file and password_command can be set")
+	}
+
+	switch {
+	case h.PasswordEnv != "":
+		password, ok := os.LookupEnv(h.PasswordEnv)
+		if !ok {
+			return fmt.Errorf("password_env: environment variable %s not set", h.PasswordEnv)
+		}
+		h.Password = Secret(password)
+	case h.PasswordFile != "":
+		passwordFile, err := expandEnv(h.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("password_file: %s", err)
+		}
+		password, err := ioutil.ReadFile(passwordFile)
+		if err != nil {
+			return fmt.Errorf("unable to read password_file: %s", err)
+		}
+		h.Password = Secret(strings.TrimRight(string(password), "\r\n"))
+	case len(h.PasswordCommand) > 0:
+		ctx, cancel := context.WithTimeout(context.Background(), secretCommandTimeout)
+		defer cancel()
+		var stdout bytes.Buffer
+		cmd := exec.CommandContext(ctx, h.PasswordCommand[0], h.PasswordCommand[1:]...)
+		cmd.Stdout = &stdout
+		// stderr is discarded on purpose, credential helpers tend to print the secret when debugging
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("password_command %s failed: %s", h.PasswordCommand[0], err)
+		}
+		h.Password = Secret(strings.TrimRight(stdout.String(), "\r\n"))
+	}
+	return nil
+}
+
+// TLSConfig holds the TLS settings used when connecting to the redfish API of a host.
+type TLSConfig struct {
+	// CAFile is a PEM bundle used to verify the BMC certificate, the system roots are used when empty.
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile are the client certificate and key presented for mutual TLS.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ServerName overrides the name used to verify the BMC certificate.
+	ServerName string `yaml:"server_name"`
+	// InsecureSkipVerify disables certificate verification, which is otherwise always done.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+	// MinVersion is the minimum TLS version accepted, one of TLS10, TLS11, TLS12 or TLS13.
+	MinVersion string `yaml:"min_version"`
+}
+
+var tlsVersions = map[string]uint16{
+	"TLS10": tls.VersionTLS10,
+	"TLS11": tls.VersionTLS11,
+	"TLS12": tls.VersionTLS12,
+	"TLS13": tls.VersionTLS13,
+}
+
+// ClientConfig builds the crypto/tls configuration described by the TLSConfig, the certificate of the server is
+// verified unless insecure_skip_verify is set.
+func (t *TLSConfig) ClientConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CAFile != "" {
+		caBundle, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read ca_file %s: %s", t.CAFile, err)
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("no certificates found in ca_file %s", t.CAFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return nil, fmt.Errorf("both cert_file and key_file must be set for client certificate authentication")
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate %s: %s", t.CertFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if t.MinVersion != "" {
+		version, ok := tlsVersions[strings.ToUpper(t.MinVersion)]
+		if !ok {
+			return nil, fmt.Errorf("unknown min_version %s", t.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	return tlsConfig, nil
+}
+
+// ConfigErrors lists every problem found while loading a configuration file.
+type ConfigErrors []error
+
+func (e ConfigErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// validate resolves the secrets of the entry and checks that it can be used to scrape a target.
+func (h *HostConfig) validate() []error {
+	var errs []error
+	if err := h.resolveSecrets(); err != nil {
+		errs = append(errs, err)
+	}
+	if h.Username == "" {
+		errs = append(errs, fmt.Errorf("username must not be empty"))
+	}
+	if _, err := h.TLS.ClientConfig(); err != nil {
+		errs = append(errs, fmt.Errorf("tls: %s", err))
+	}
+	if h.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("timeout must not be negative"))
+	}
+	if h.PollInterval < 0 || h.PollJitter < 0 {
+		errs = append(errs, fmt.Errorf("poll_interval and poll_jitter must not be negative"))
+	}
+	if h.MaxConcurrentRequests < 0 || h.RequestsPerSecond < 0 {
+		errs = append(errs, fmt.Errorf("max_concurrent_requests and requests_per_second must not be negative"))
+	}
+	if h.Retry.MaxRetries < 0 || h.Retry.InitialBackoff < 0 || h.Retry.MaxBackoff < 0 {
+		errs = append(errs, fmt.Errorf("retry settings must not be negative"))
+	}
+	if h.CircuitBreaker.FailureThreshold < 0 || h.CircuitBreaker.Cooldown < 0 {
+		errs = append(errs, fmt.Errorf("circuit_breaker settings must not be negative"))
+	}
+	return errs
+}
+
+// LoadConfig strictly parses and validates the configuration file, all problems found are returned as ConfigErrors.
+func LoadConfig(configFile string) (*Config, error) {
 	var c = &Config{}
 
 	yamlFile, err := ioutil.ReadFile(configFile)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(yamlFile, c); err != nil {
+		return nil, err
+	}
+
+	var errs ConfigErrors
+	for _, name := range sortedKeys(c.Hosts) {
+		hostConfig := c.Hosts[name]
+		for _, err := range hostConfig.validate() {
+			errs = append(errs, fmt.Errorf("host %s: %s", name, err))
+		}
+		c.Hosts[name] = hostConfig
+	}
+	for i := range c.HostRules {
+		if err := c.HostRules[i].compile(); err != nil {
+			errs = append(errs, fmt.Errorf("host_rules[%d]: %s", i, err))
+		}
+		for _, err := range c.HostRules[i].validate() {
+			errs = append(errs, fmt.Errorf("host_rules[%d]: %s", i, err))
+		}
+	}
+	for _, name := range sortedKeys(c.Groups) {
+		hostConfig := c.Groups[name]
+		for _, err := range hostConfig.validate() {
+			errs = append(errs, fmt.Errorf("group %s: %s", name, err))
+		}
+		c.Groups[name] = hostConfig
+	}
+	for _, name := range sortedKeys(c.Modules) {
+		module := c.Modules[name]
+		if err := module.ScrapeOptions().Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("module %s: %s", name, err))
+		}
+		if module.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("module %s: timeout must not be negative", name))
+		}
+		if module.Auth != nil {
+			if err := module.Auth.resolveSecrets(); err != nil {
+				errs = append(errs, fmt.Errorf("module %s: auth: %s", name, err))
+			}
+			if _, err := module.Auth.TLS.ClientConfig(); err != nil {
+				errs = append(errs, fmt.Errorf("module %s: auth: tls: %s", name, err))
+			}
+		}
+		c.Modules[name] = module
+	}
+	polled := make(map[PollTarget]bool)
+	for i, target := range c.Polling.Targets {
+		if target.Target == "" {
+			errs = append(errs, fmt.Errorf("polling.targets[%d]: target must not be empty", i))
+		}
+		if _, ok := c.Groups[target.Group]; target.Group != "" && !ok {
+			errs = append(errs, fmt.Errorf("polling.targets[%d]: unknown group %s", i, target.Group))
+		}
+		if _, ok := c.Modules[target.Module]; target.Module != "" && !ok {
+			errs = append(errs, fmt.Errorf("polling.targets[%d]: unknown module %s", i, target.Module))
+		}
+		if polled[target] {
+			errs = append(errs, fmt.Errorf("polling.targets[%d]: duplicate target %s", i, target.Target))
+		}
+		polled[target] = true
+	}
+	if c.LogSinks.Loki != nil {
+		for _, err := range c.LogSinks.Loki.validate() {
+			errs = append(errs, fmt.Errorf("log_sinks.loki: %s", err))
+		}
 	}
-	if err := yaml.Unmarshal(yamlFile, c); err != nil {
+	if c.LogSinks.Syslog != nil {
+		for _, err := range c.LogSinks.Syslog.validate() {
+			errs = append(errs, fmt.Errorf("log_sinks.syslog: %s", err))
+		}
+	}
+	if c.LogSinks.Loki != nil || c.LogSinks.Syslog != nil {
+		incremental := false
+		for _, module := range c.Modules {
+			incremental = incremental || module.LogEntries.Incremental
+		}
+		if !incremental {
+			errs = append(errs, fmt.Errorf("log_sinks: only new entries fetched with log_entries.incremental are forwarded, but no module sets it"))
+		}
+	}
+	if c.Loglevel != "" {
+		if _, err := alog.ParseLevel(c.Loglevel); err != nil {
+			errs = append(errs, fmt.Errorf("loglevel: %s", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return c, nil
+}
+
+// sortedKeys returns the keys of a map[string]HostConfig or map[string]ModuleConfig in order, so that errors are
+// always reported in the same order.
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]HostConfig:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[string]ModuleConfig:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ReloadConfig loads the configuration file and only replaces the running configuration when it is valid.
+func (sc *SafeConfig) ReloadConfig(configFile string) error {
+	c, err := LoadConfig(configFile)
+	if err != nil {
 		return err
 	}
 
@@ -42,22 +663,39 @@ func (sc *SafeConfig) ReloadConfig(configFile string) error {
 	return nil
 }
 
-func (sc *SafeConfig) HostConfigForTarget(target string) (*HostConfig, error) {
+// HostConfigForTarget returns the HostConfig for the target together with a description of the entry it was taken
+// from. An exact entry in hosts wins over the host_rules, which win over the default entry.
+func (sc *SafeConfig) HostConfigForTarget(target string) (*HostConfig, string, error) {
 	sc.Lock()
 	defer sc.Unlock()
-	if hostConfig, ok := sc.C.Hosts[target]; ok {
-		return &HostConfig{
-			Username: hostConfig.Username,
-			Password: hostConfig.Password,
-		}, nil
+	if hostConfig, ok := sc.C.Hosts[target]; ok && target != "default" {
+		return &hostConfig, fmt.Sprintf("hosts[%s]", target), nil
+	}
+	if rule, index := matchHostRule(sc.C.HostRules, target); rule != nil {
+		hostConfig := rule.HostConfig
+		return &hostConfig, fmt.Sprintf("host_rules[%d] %s", index, rule), nil
 	}
 	if hostConfig, ok := sc.C.Hosts["default"]; ok {
-		return &HostConfig{
-			Username: hostConfig.Username,
-			Password: hostConfig.Password,
-		}, nil
+		return &hostConfig, "hosts[default]", nil
+	}
+	return &HostConfig{}, "", fmt.Errorf("no credentials found for target %s", target)
+}
+
+// ModuleConfig returns the named module, an empty name selects the "default" module and falls back to running all
+// collectors when no such module is configured.
+func (sc *SafeConfig) ModuleConfig(name string) (*ModuleConfig, error) {
+	sc.Lock()
+	defer sc.Unlock()
+	if module, ok := sc.C.Modules[name]; ok {
+		return &module, nil
 	}
-	return &HostConfig{}, fmt.Errorf("no credentials found for target %s", target)
+	if name == "" {
+		if module, ok := sc.C.Modules["default"]; ok {
+			return &module, nil
+		}
+		return &ModuleConfig{}, nil
+	}
+	return nil, fmt.Errorf("unknown module %s", name)
 }
 
 // HostConfigForGroup checks the configuration for a matching group config and returns the configured HostConfig for
@@ -71,7 +709,21 @@ func (sc *SafeConfig) HostConfigForGroup(group string) (*HostConfig, error) {
 	return &HostConfig{}, fmt.Errorf("no credentials found for group %s", group)
 }
 
-func (sc *SafeConfig) AppLogLevel() (string) {
+// PollTargets returns the targets polled in the background.
+func (sc *SafeConfig) PollTargets() []PollTarget {
+	sc.Lock()
+	defer sc.Unlock()
+	return append([]PollTarget(nil), sc.C.Polling.Targets...)
+}
+
+// LogSinks returns the configuration of the log sinks.
+func (sc *SafeConfig) LogSinks() LogSinksConfig {
+	sc.Lock()
+	defer sc.Unlock()
+	return sc.C.LogSinks
+}
+
+func (sc *SafeConfig) AppLogLevel() string {
 	sc.Lock()
 	defer sc.Unlock()
 	logLevel := sc.C.Loglevel
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loadConfig loads the configuration from a temporary file.
+func loadConfig(t *testing.T, config string) (*Config, error) {
+	t.Helper()
+	file, err := ioutil.TempFile("", "redfish_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(config)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return LoadConfig(file.Name())
+}
+
+func TestLoadConfigValid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redfish_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	passwordFile := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(passwordFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("REDFISH_EXPORTER_TEST_PASSWORD", "from-env")
+	defer os.Unsetenv("REDFISH_EXPORTER_TEST_PASSWORD")
+
+	c, err := loadConfig(t, `
+hosts:
+  default:
+    username: admin
+    password: pa$$word
+  file:
+    username: admin
+    password_file: `+passwordFile+`
+  env:
+    username: admin
+    password_env: REDFISH_EXPORTER_TEST_PASSWORD
+host_rules:
+  - cidr: 10.0.0.0/8
+    username: admin
+    password: secret
+modules:
+  health:
+    collectors: [chassis]
+    exclude: [log_services, system.memory]
+    timeout: 5s
+polling:
+  targets:
+    - target: 10.0.0.1
+      module: health
+`)
+	if err != nil {
+		t.Fatalf("LoadConfig() = %s", err)
+	}
+	passwords := map[string]Secret{
+		"default": "pa$$word",
+		"file":    "from-file",
+		"env":     "from-env",
+	}
+	for host, want := range passwords {
+		if got := c.Hosts[host].Password; got != want {
+			t.Errorf("password of host %s = %q, want %q", host, string(got), string(want))
+		}
+	}
+	if c.HostRules[0].network == nil {
+		t.Errorf("host rule was not compiled")
+	}
+}
+
+func TestLoadConfigStrict(t *testing.T) {
+	_, err := loadConfig(t, `
+hosts:
+  default:
+    username: admin
+    pasword: typo
+`)
+	if err == nil || !strings.Contains(err.Error(), "field pasword not found") {
+		t.Fatalf("LoadConfig() = %v, want an unknown field error", err)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	_, err := loadConfig(t, `
+hosts:
+  b:
+    password: secret
+  a:
+    username: admin
+    password: secret
+    password_file: /nonexistent
+    timeout: -1s
+    tls:
+      cert_file: /tmp/cert.pem
+host_rules:
+  - cidr: 10.0.0.0/8
+    glob: "*"
+    username: admin
+modules:
+  m:
+    collectors: [storage]
+    exclude: [unknown]
+polling:
+  targets:
+    - target: ""
+      module: missing
+loglevel: verbose
+`)
+	errs, ok := err.(ConfigErrors)
+	if !ok {
+		t.Fatalf("LoadConfig() = %v, want ConfigErrors", err)
+	}
+	want := []string{
+		"host a: only one of password, password_env, password_file and password_command can be set",
+		"host a: tls: both cert_file and key_file must be set for client certificate authentication",
+		"host a: timeout must not be negative",
+		"host b: username must not be empty",
+		"host_rules[0]: exactly one of cidr, glob and regex must be set",
+		"module m: unknown collector storage",
+		"polling.targets[0]: target must not be empty",
+		"polling.targets[0]: unknown module missing",
+		`loglevel: invalid level`,
+	}
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+	if len(got) != len(want) {
+		t.Fatalf("LoadConfig() errors =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("error %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestLoadConfigSecretsNotInErrors(t *testing.T) {
+	_, err := loadConfig(t, `
+hosts:
+  a:
+    password: hunter2
+`)
+	if err == nil {
+		t.Fatal("LoadConfig() = nil, want an error")
+	}
+	if strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("LoadConfig() error %q contains the password", err)
+	}
+}
+
+func TestScrapeOptionsDetail(t *testing.T) {
+	c, err := loadConfig(t, `
+modules:
+  default: {}
+  detail:
+    log_entries:
+      detail: true
+  nodetail:
+    log_entries:
+      detail: false
+`)
+	if err != nil {
+		t.Fatalf("LoadConfig() = %s", err)
+	}
+	want := map[string]bool{"default": true, "detail": true, "nodetail": false}
+	for name, detail := range want {
+		module := c.Modules[name]
+		if got := module.ScrapeOptions().LogEntries.Detail; got != detail {
+			t.Errorf("detail of module %s = %t, want %t", name, got, detail)
+		}
+	}
+}
+
+func TestLoadConfigLogSinks(t *testing.T) {
+	sinks := `
+log_sinks:
+  syslog:
+    address: 127.0.0.1:514
+`
+	_, err := loadConfig(t, sinks+`
+modules:
+  logs:
+    log_entries:
+      incremental: false
+`)
+	if err == nil || !strings.HasPrefix(err.Error(), "log_sinks: only new entries fetched with log_entries.incremental are forwarded") {
+		t.Errorf("LoadConfig() without an incremental module = %v, want a log_sinks error", err)
+	}
+	if _, err := loadConfig(t, sinks+`
+modules:
+  logs:
+    log_entries:
+      incremental: true
+`); err != nil {
+		t.Errorf("LoadConfig() with an incremental module = %s", err)
+	}
+}
+
+func TestApplyAuth(t *testing.T) {
+	host := &HostConfig{Username: "host", Password: "host-pass", Timeout: 10}
+	module := &ModuleConfig{Auth: &HostConfig{Username: "module", TLS: TLSConfig{InsecureSkipVerify: true}}}
+	got := module.ApplyAuth(host)
+	want := &HostConfig{Username: "module", Password: "host-pass", Timeout: 10, TLS: TLSConfig{InsecureSkipVerify: true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ApplyAuth() = %+v, want %+v", got, want)
+	}
+	if host.Username != "host" {
+		t.Errorf("ApplyAuth() modified the host config")
+	}
+}
+
+func TestSyslogSinkConfigStructuredDataID(t *testing.T) {
+	tests := map[string]bool{
+		"":                                       true,
+		"redfish@32473":                          true,
+		"redfish@32473.1":                        true,
+		"redfish":                                false,
+		"redfish@":                               false,
+		"redfish@example":                        false,
+		"red fish@32473":                         false,
+		"red=fish@32473":                         false,
+		`red"fish@32473`:                         false,
+		"red]fish@32473":                         false,
+		"red@fish@32473":                         false,
+		"redfish@32473.":                         false,
+		"très@32473":                             false,
+		"redfish_exporter_bmc_log_entries@32473": false,
+	}
+	for id, valid := range tests {
+		config := SyslogSinkConfig{Address: "127.0.0.1:514", StructuredDataID: id}
+		if errs := config.validate(); (len(errs) == 0) != valid {
+			t.Errorf("validate() of structured_data_id %q = %v, want valid %t", id, errs, valid)
+		}
+	}
+}
@@ -1,11 +1,12 @@
 module github.com/jenningsloy318/redfish_exporter
 
-go 1.12
+go 1.16
 
 require (
 	github.com/apex/log v1.9.0
 	github.com/go-kit/log v0.2.0
 	github.com/prometheus/client_golang v1.11.1
+	github.com/prometheus/client_model v0.2.0
 	github.com/prometheus/common v0.26.0
 	github.com/prometheus/exporter-toolkit v0.5.0
 	github.com/stmcginnis/gofish v0.14.0
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// HostRule maps every target matching its cidr, glob or regex to the inlined HostConfig.
+type HostRule struct {
+	CIDR       string `yaml:"cidr"`
+	Glob       string `yaml:"glob"`
+	Regex      string `yaml:"regex"`
+	HostConfig `yaml:",inline"`
+
+	network *net.IPNet
+	regex   *regexp.Regexp
+}
+
+// Rule kinds ordered from the least to the most specific one, exact entries in hosts always win.
+const (
+	ruleKindRegex = iota
+	ruleKindGlob
+	ruleKindCIDR
+)
+
+// compile validates the rule and prepares its matcher.
+func (r *HostRule) compile() error {
+	matchers := 0
+	for _, set := range []bool{r.CIDR != "", r.Glob != "", r.Regex != ""} {
+		if set {
+			matchers++
+		}
+	}
+	if matchers != 1 {
+		return fmt.Errorf("exactly one of cidr, glob and regex must be set")
+	}
+
+	switch {
+	case r.CIDR != "":
+		_, network, err := net.ParseCIDR(r.CIDR)
+		if err != nil {
+			return err
+		}
+		r.network = network
+	case r.Glob != "":
+		if _, err := path.Match(r.Glob, ""); err != nil {
+			return fmt.Errorf("invalid glob %s: %s", r.Glob, err)
+		}
+	case r.Regex != "":
+		// anchor the expression so that it has to match the whole target
+		regex, err := regexp.Compile("^(?:" + r.Regex + ")$")
+		if err != nil {
+			return err
+		}
+		r.regex = regex
+	}
+	return nil
+}
+
+// match reports whether the target matches the rule, and if so the rule kind and its specificity within that kind:
+// the prefix length for cidr and the number of literal characters for glob rules.
+func (r *HostRule) match(target string) (bool, int, int) {
+	host := target
+	if h, _, err := net.SplitHostPort(target); err == nil {
+		host = h
+	}
+
+	switch {
+	case r.network != nil:
+		ip := net.ParseIP(host)
+		if ip == nil || !r.network.Contains(ip) {
+			return false, 0, 0
+		}
+		ones, _ := r.network.Mask.Size()
+		return true, ruleKindCIDR, ones
+	case r.Glob != "":
+		if ok, _ := path.Match(strings.ToLower(r.Glob), strings.ToLower(host)); !ok {
+			return false, 0, 0
+		}
+		literals := len(r.Glob) - strings.Count(r.Glob, "*") - strings.Count(r.Glob, "?")
+		return true, ruleKindGlob, literals
+	case r.regex != nil:
+		return r.regex.MatchString(target) || r.regex.MatchString(host), ruleKindRegex, 0
+	}
+	return false, 0, 0
+}
+
+// String describes the rule for log messages.
+func (r *HostRule) String() string {
+	switch {
+	case r.CIDR != "":
+		return fmt.Sprintf("cidr %s", r.CIDR)
+	case r.Glob != "":
+		return fmt.Sprintf("glob %s", r.Glob)
+	default:
+		return fmt.Sprintf("regex %s", r.Regex)
+	}
+}
+
+// matchHostRule returns the most specific rule matching the target: cidr rules win over glob rules which win over
+// regex rules, longer prefixes and globs with more literal characters are preferred, and the first rule in the
+// configuration wins a tie.
+func matchHostRule(rules []HostRule, target string) (*HostRule, int) {
+	var (
+		best            *HostRule
+		bestIndex       int
+		bestKind        int
+		bestSpecificity int
+	)
+	for i := range rules {
+		ok, kind, specificity := rules[i].match(target)
+		if !ok {
+			continue
+		}
+		if best == nil || kind > bestKind || (kind == bestKind && specificity > bestSpecificity) {
+			best, bestIndex, bestKind, bestSpecificity = &rules[i], i, kind, specificity
+		}
+	}
+	return best, bestIndex
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"testing"
+)
+
+func compileHostRules(t *testing.T, rules []HostRule) []HostRule {
+	t.Helper()
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			t.Fatalf("rule %d: %s", i, err)
+		}
+	}
+	return rules
+}
+
+func TestMatchHostRule(t *testing.T) {
+	rules := compileHostRules(t, []HostRule{
+		{Regex: `bmc-[0-9]+.*`},
+		{Glob: "*.dc1.example.com"},
+		{Glob: "bmc-*.dc1.example.com"},
+		{CIDR: "10.0.0.0/8"},
+		{CIDR: "10.20.0.0/16"},
+		{Regex: `10\.20\..*`},
+		{Glob: "10.20.*"},
+		{CIDR: "10.20.0.0/16"},
+		{Glob: "bmc-?.dc1.example.com"},
+	})
+
+	tests := []struct {
+		name   string
+		target string
+		// index of the expected rule, -1 when no rule matches
+		want int
+	}{
+		{"cidr wins over glob and regex", "10.20.1.1", 4},
+		{"longer prefix wins", "10.20.1.1:443", 4},
+		{"shorter prefix when only it matches", "10.30.1.1", 3},
+		{"glob wins over regex", "bmc-12.dc1.example.com", 2},
+		{"glob with more literals wins", "bmc-1.dc1.example.com", 2},
+		{"glob ignores the port", "node.dc1.example.com:8443", 1},
+		{"glob is case insensitive", "NODE.DC1.EXAMPLE.COM", 1},
+		{"regex when nothing else matches", "bmc-7.lab", 0},
+		{"regex is anchored", "xbmc-7.lab", -1},
+		{"no match", "192.168.1.1", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, index := matchHostRule(rules, tt.target)
+			if tt.want == -1 {
+				if rule != nil {
+					t.Fatalf("matchHostRule(%q) = rule %d (%s), want no match", tt.target, index, rule)
+				}
+				return
+			}
+			if rule == nil {
+				t.Fatalf("matchHostRule(%q) = no match, want rule %d", tt.target, tt.want)
+			}
+			if index != tt.want || rule != &rules[tt.want] {
+				t.Errorf("matchHostRule(%q) = rule %d (%s), want rule %d (%s)", tt.target, index, rule, tt.want, &rules[tt.want])
+			}
+		})
+	}
+}
+
+func TestMatchHostRuleTieBreak(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []HostRule
+		target string
+		want   int
+	}{
+		{
+			name:   "first of equal cidrs",
+			rules:  []HostRule{{CIDR: "10.0.0.0/24"}, {CIDR: "10.0.0.0/24"}},
+			target: "10.0.0.1",
+			want:   0,
+		},
+		{
+			name:   "first of globs with as many literals",
+			rules:  []HostRule{{Glob: "bmc-*.example.com"}, {Glob: "*-1.example.com"}},
+			target: "bmc-1.example.com",
+			want:   0,
+		},
+		{
+			name:   "first of matching regexes",
+			rules:  []HostRule{{Regex: "bmc-.*"}, {Regex: "bmc-[0-9]"}},
+			target: "bmc-1",
+			want:   0,
+		},
+		{
+			name:   "later more specific rule wins over earlier one",
+			rules:  []HostRule{{Regex: "bmc-.*"}, {Glob: "bmc-*"}, {CIDR: "0.0.0.0/0"}},
+			target: "bmc-1",
+			want:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := compileHostRules(t, tt.rules)
+			if _, index := matchHostRule(rules, tt.target); index != tt.want {
+				t.Errorf("matchHostRule(%q) = rule %d, want rule %d", tt.target, index, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostRuleCompile(t *testing.T) {
+	tests := []struct {
+		name string
+		rule HostRule
+	}{
+		{"no matcher", HostRule{}},
+		{"two matchers", HostRule{CIDR: "10.0.0.0/8", Glob: "*"}},
+		{"invalid cidr", HostRule{CIDR: "10.0.0.0/33"}},
+		{"invalid glob", HostRule{Glob: "bmc-["}},
+		{"invalid regex", HostRule{Regex: "bmc-("}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.compile(); err == nil {
+				t.Errorf("compile() = nil, want an error")
+			}
+		})
+	}
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
+	"strconv"
+	"sync"
 	"syscall"
+	"time"
 
 	alog "github.com/apex/log"
 	kitlog "github.com/go-kit/log"
@@ -30,15 +36,53 @@ var (
 		"config.file",
 		"Path to configuration file.",
 	).String()
+	configCheck = kingpin.Flag(
+		"config.check",
+		"Validate the configuration file and exit.",
+	).Bool()
 	webConfig     = webflag.AddFlags(kingpin.CommandLine)
 	listenAddress = kingpin.Flag(
 		"web.listen-address",
 		"Address to listen on for web interface and telemetry.",
 	).Default(":9610").String()
+	timeoutOffset = kingpin.Flag(
+		"scrape.timeout-offset",
+		"Offset to subtract from the timeout sent by Prometheus in the X-Prometheus-Scrape-Timeout-Seconds header.",
+	).Default("500ms").Duration()
+	maxScrapeTimeout = kingpin.Flag(
+		"scrape.max-timeout",
+		"Upper bound of the duration of a scrape, also when neither Prometheus nor the configuration sets a timeout.",
+	).Default("2m").Duration()
+	maxConcurrentTargets = kingpin.Flag(
+		"scrape.max-concurrent-targets",
+		"Maximum number of targets scraped or polled at the same time, 0 means no limit.",
+	).Default("0").Int()
+	coalesceMaxAge = kingpin.Flag(
+		"scrape.coalesce-max-age",
+		"Answer scrapes of a target with the result of a previous scrape of it that is at most this old, 0 only shares scrapes still running.",
+	).Default("0s").Duration()
+	collectorWorkers = kingpin.Flag(
+		"collector.workers",
+		"Number of workers fetching redfish resources, shared by all scrapes.",
+	).Default("16").Int()
+	logCursorFile = kingpin.Flag(
+		"collector.log-cursor-file",
+		"File persisting the position of incrementally fetched log entries across restarts, empty keeps it in memory only.",
+	).Default("").String()
+	sessionIdleTimeout = kingpin.Flag(
+		"redfish.session-idle-timeout",
+		"Log out of redfish sessions unused for this long, 0 logs in and out on every scrape.",
+	).Default("5m").Duration()
 	sc = &SafeConfig{
 		C: &Config{},
 	}
-	reloadCh chan chan error
+	reloadCh     chan chan error
+	sessionCache *collector.SessionCache
+	workerPool   *collector.WorkerPool
+	logPipeline  *collector.LogPipeline
+	poller       *Poller
+	coalescer    *scrapeCoalescer
+	targetSlots  chan struct{}
 )
 
 func init() {
@@ -54,10 +98,11 @@ func reloadHandler(configLoggerCtx *alog.Entry) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == "POST" || r.Method == "PUT" {
 			configLoggerCtx.Info("Triggered configuration reload from /-/reload HTTP endpoint")
-			err := sc.ReloadConfig(*configFile)
+			err := reloadConfig()
 			if err != nil {
 				configLoggerCtx.WithError(err).Error("failed to reload config file")
 				http.Error(w, "failed to reload config file", http.StatusInternalServerError)
+				return
 			}
 			configLoggerCtx.WithField("operation", "sc.ReloadConfig").Info("config file reloaded")
 
@@ -72,6 +117,80 @@ func reloadHandler(configLoggerCtx *alog.Entry) http.HandlerFunc {
 	}
 }
 
+// reloadConfig reloads the config file. The cached sessions of changed credentials or client options are no longer
+// used and are logged out once idle, in-flight scrapes keep theirs.
+func reloadConfig() error {
+	if err := sc.ReloadConfig(*configFile); err != nil {
+		return err
+	}
+	poller.Update(sc.PollTargets())
+	applyLogSinks()
+	return nil
+}
+
+// runningLogSink is a log sink along with the configuration it was started with.
+type runningLogSink struct {
+	config interface{}
+	sink   collector.LogSink
+}
+
+var (
+	logSinksMu sync.Mutex
+	// logSinks are the running log sinks by kind.
+	logSinks = make(map[string]runningLogSink)
+)
+
+// applyLogSinks starts the log sinks of the current configuration, the sinks whose configuration did not change keep
+// running. The previous ones are closed once their queued entries are forwarded.
+func applyLogSinks() {
+	logSinksMu.Lock()
+	defer logSinksMu.Unlock()
+	running := make(map[string]runningLogSink)
+	var sinks []collector.LogSink
+	config := sc.LogSinks()
+	if config.Loki != nil {
+		if sink, ok := logSinks["loki"]; ok && reflect.DeepEqual(sink.config, *config.Loki) {
+			running["loki"] = sink
+		} else if options, err := config.Loki.Options(); err != nil {
+			rootLoggerCtx.WithField("operation", "applyLogSinks()").WithError(err).Error("error configuring the loki sink")
+		} else {
+			running["loki"] = runningLogSink{config: *config.Loki, sink: collector.NewLokiSink(options, rootLoggerCtx.WithField("component", "loki_sink"))}
+		}
+	}
+	if config.Syslog != nil {
+		if sink, ok := logSinks["syslog"]; ok && reflect.DeepEqual(sink.config, *config.Syslog) {
+			running["syslog"] = sink
+		} else if options, err := config.Syslog.Options(); err != nil {
+			rootLoggerCtx.WithField("operation", "applyLogSinks()").WithError(err).Error("error configuring the syslog sink")
+		} else {
+			running["syslog"] = runningLogSink{config: *config.Syslog, sink: collector.NewSyslogSink(options, rootLoggerCtx.WithField("component", "syslog_sink"))}
+		}
+	}
+	for _, name := range []string{"loki", "syslog"} {
+		if sink, ok := running[name]; ok {
+			sinks = append(sinks, sink.sink)
+		}
+	}
+	logPipeline.SetSinks(sinks)
+	for name, sink := range logSinks {
+		if running[name].sink != sink.sink {
+			sink.sink.Close()
+		}
+	}
+	logSinks = running
+}
+
+// closeLogSinks stops forwarding log entries and closes the sinks once their queued entries are forwarded.
+func closeLogSinks() {
+	logSinksMu.Lock()
+	defer logSinksMu.Unlock()
+	logPipeline.SetSinks(nil)
+	for _, sink := range logSinks {
+		sink.sink.Close()
+	}
+	logSinks = make(map[string]runningLogSink)
+}
+
 func SetLogLevel() {
 	logLevel, err := alog.ParseLevel(sc.AppLogLevel())
 	if err != nil {
@@ -81,6 +200,112 @@ func SetLogLevel() {
 	alog.SetLevel(logLevel)
 }
 
+// scrapeTimeout returns how long a scrape may take. The timeout Prometheus sends in the
+// X-Prometheus-Scrape-Timeout-Seconds header minus the offset is used unless the host config sets its own timeout,
+// the module timeout caps both and --scrape.max-timeout caps all of them.
+func scrapeTimeout(r *http.Request, hostConfig *HostConfig, module *ModuleConfig) time.Duration {
+	var timeout time.Duration
+	if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil && seconds > 0 {
+			timeout = time.Duration(seconds*float64(time.Second)) - *timeoutOffset
+			if timeout <= 0 {
+				timeout = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+	if hostConfig.Timeout > 0 {
+		timeout = hostConfig.Timeout
+	}
+	if module.Timeout > 0 && (timeout == 0 || module.Timeout < timeout) {
+		timeout = module.Timeout
+	}
+	if *maxScrapeTimeout > 0 && (timeout == 0 || *maxScrapeTimeout < timeout) {
+		timeout = *maxScrapeTimeout
+	}
+	return timeout
+}
+
+// acquireTargetSlot waits until fewer than --scrape.max-concurrent-targets targets are scraped, the returned func
+// must be called once the scrape is done.
+func acquireTargetSlot(ctx context.Context) (func(), error) {
+	if targetSlots == nil {
+		return func() {}, nil
+	}
+	select {
+	case targetSlots <- struct{}{}:
+		return func() { <-targetSlots }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("no free slot to scrape the target: %s", ctx.Err())
+	}
+}
+
+// maxHostConfigMatches bounds the targets whose host config entry is remembered, the entries of all targets are
+// logged again once it is reached.
+const maxHostConfigMatches = 10000
+
+// hostConfigMatch is a target scraped with or without a group.
+type hostConfigMatch struct {
+	target string
+	group  string
+}
+
+var (
+	hostConfigMatchesMu sync.Mutex
+	// hostConfigMatches are the entries of the configuration the host config of each target was last taken from.
+	hostConfigMatches = make(map[hostConfigMatch]string)
+)
+
+// hostConfigFor returns the HostConfig of the group when one is given and of the target otherwise. The entry it was
+// taken from is logged the first time a target is scraped and whenever it changes.
+func hostConfigFor(target string, group string, logger *alog.Entry) (*HostConfig, error) {
+	var (
+		hostConfig *HostConfig
+		rule       string
+		err        error
+	)
+	if group != "" {
+		hostConfig, err = sc.HostConfigForGroup(group)
+		rule = fmt.Sprintf("groups[%s]", group)
+	} else {
+		hostConfig, rule, err = sc.HostConfigForTarget(target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if logHostConfigMatch(hostConfigMatch{target: target, group: group}, rule) {
+		logger.WithField("rule", rule).Info("host config matched")
+	}
+	return hostConfig, nil
+}
+
+// logHostConfigMatch remembers the entry the host config of the target was taken from and returns whether it
+// changed.
+func logHostConfigMatch(match hostConfigMatch, rule string) bool {
+	hostConfigMatchesMu.Lock()
+	defer hostConfigMatchesMu.Unlock()
+	if previous, ok := hostConfigMatches[match]; ok && previous == rule {
+		return false
+	}
+	if len(hostConfigMatches) >= maxHostConfigMatches {
+		hostConfigMatches = make(map[hostConfigMatch]string)
+	}
+	hostConfigMatches[match] = rule
+	return true
+}
+
+// newTargetCollector builds the RedfishCollector scraping the target with the host config of the group or target
+// and the settings of the module, the energy estimate is only passed for polled targets.
+func newTargetCollector(ctx context.Context, target string, hostConfig *HostConfig, module *ModuleConfig, energy *collector.EnergyEstimate, logger *alog.Entry) (*collector.RedfishCollector, error) {
+	hostConfig = module.ApplyAuth(hostConfig)
+	clientOptions, err := hostConfig.ClientOptions()
+	if err != nil {
+		return nil, fmt.Errorf("error building tls config: %s", err)
+	}
+	options := module.ScrapeOptions()
+	options.Energy = energy
+	return collector.NewRedfishCollector(ctx, sessionCache, workerPool, logPipeline, target, hostConfig.Username, string(hostConfig.Password), clientOptions, options, logger), nil
+}
+
 // define new http handleer
 func metricsHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -90,41 +315,76 @@ func metricsHandler() http.HandlerFunc {
 			http.Error(w, "'target' parameter must be specified", 400)
 			return
 		}
+		group := r.URL.Query().Get("group")
+		moduleName := r.URL.Query().Get("module")
 		targetLoggerCtx := rootLoggerCtx.WithField("target", target)
-		targetLoggerCtx.Info("scraping target host")
 
-		var (
-			hostConfig *HostConfig
-			err        error
-			ok         bool
-			group      []string
-		)
+		// polled targets are served from memory
+		if result, ok := poller.Result(PollTarget{Target: target, Group: group, Module: moduleName}); ok {
+			targetLoggerCtx.Debug("serving cached metrics of polled target")
+			registry.MustRegister(result.ageGauge())
+			gatherers := prometheus.Gatherers{
+				prometheus.DefaultGatherer,
+				registry,
+				result,
+			}
+			promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+			return
+		}
+		targetLoggerCtx.Info("scraping target host")
 
-		group, ok = r.URL.Query()["group"]
+		hostConfig, err := hostConfigFor(target, group, targetLoggerCtx)
+		if err != nil {
+			targetLoggerCtx.WithError(err).Error("error getting credentials")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		if ok && len(group[0]) >= 1 {
-			// Trying to get hostConfig from group.
-			if hostConfig, err = sc.HostConfigForGroup(group[0]); err != nil {
-				targetLoggerCtx.WithError(err).Error("error getting credentials")
-				return
-			}
+		module, err := sc.ModuleConfig(moduleName)
+		if err != nil {
+			targetLoggerCtx.WithError(err).Error("error getting module")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		// Always falling back to single host config when group config failed.
-		if hostConfig == nil {
-			if hostConfig, err = sc.HostConfigForTarget(target); err != nil {
-				targetLoggerCtx.WithError(err).Error("error getting credentials")
-				return
+		// concurrent scrapes share one walk of the BMC, which is only cancelled once all clients waiting for it went
+		// away
+		key := PollTarget{Target: target, Group: group, Module: moduleName}
+		timeout := scrapeTimeout(r, hostConfig, module)
+		result, shared := coalescer.Do(r.Context(), key, func(ctx context.Context) *pollResult {
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			release, err := acquireTargetSlot(ctx)
+			if err != nil {
+				targetLoggerCtx.WithError(err).Warn("too many targets scraped at the same time")
+				return &pollResult{err: err, time: time.Now()}
+			}
+			defer release()
+			collector, err := newTargetCollector(ctx, target, hostConfig, module, nil, targetLoggerCtx)
+			if err != nil {
+				targetLoggerCtx.WithError(err).Error("error creating collector")
+				return &pollResult{err: err, time: time.Now()}
 			}
+			scrapeRegistry := prometheus.NewRegistry()
+			scrapeRegistry.MustRegister(collector)
+			families, err := scrapeRegistry.Gather()
+			return &pollResult{families: families, err: err, time: time.Now()}
+		})
+		if result == nil {
+			return
+		}
+		if shared {
+			targetLoggerCtx.Debug("serving metrics of a coalesced scrape")
+			registry.MustRegister(result.ageGauge())
 		}
-
-		collector := collector.NewRedfishCollector(target, hostConfig.Username, hostConfig.Password, targetLoggerCtx)
-		registry.MustRegister(collector)
 		gatherers := prometheus.Gatherers{
 			prometheus.DefaultGatherer,
 			registry,
+			result,
 		}
-		// Delegate http serving to Prometheus client library, which will call collector.Collect.
 		h := promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{})
 		h.ServeHTTP(w, r)
 
@@ -138,6 +398,37 @@ func main() {
 	kitlogger := kitlog.NewLogfmtLogger(os.Stderr)
 
 	configLoggerCtx := rootLoggerCtx.WithField("config", *configFile)
+
+	if *configCheck {
+		if _, err := LoadConfig(*configFile); err != nil {
+			fmt.Fprintf(os.Stderr, "config file %s is invalid:\n", *configFile)
+			if errs, ok := err.(ConfigErrors); ok {
+				for _, err := range errs {
+					fmt.Fprintf(os.Stderr, "  - %s\n", err)
+				}
+			} else {
+				fmt.Fprintf(os.Stderr, "  - %s\n", err)
+			}
+			os.Exit(1)
+		}
+		fmt.Printf("config file %s is valid\n", *configFile)
+		os.Exit(0)
+	}
+
+	sessionCache = collector.NewSessionCache(*sessionIdleTimeout, rootLoggerCtx.WithField("component", "sessions"))
+	go sessionCache.Run(context.Background())
+	workerPool = collector.NewWorkerPool(*collectorWorkers)
+	cursors, err := collector.NewLogCursorStore(*logCursorFile, rootLoggerCtx.WithField("component", "log_cursors"))
+	if err != nil {
+		rootLoggerCtx.WithError(err).Error("error loading log cursors")
+		panic(err)
+	}
+	logPipeline = &collector.LogPipeline{
+		Cursors:    cursors,
+		Registries: collector.NewMessageRegistries(rootLoggerCtx.WithField("component", "registries")),
+	}
+	go cursors.Run(context.Background())
+
 	configLoggerCtx.Info("starting app")
 	// load config  first time
 	if err := sc.ReloadConfig(*configFile); err != nil {
@@ -148,6 +439,14 @@ func main() {
 	configLoggerCtx.WithField("operation", "sc.ReloadConfig").Info("config file loaded")
 
 	SetLogLevel()
+	applyLogSinks()
+
+	if *maxConcurrentTargets > 0 {
+		targetSlots = make(chan struct{}, *maxConcurrentTargets)
+	}
+	coalescer = newScrapeCoalescer(*coalesceMaxAge)
+	poller = NewPoller(rootLoggerCtx.WithField("component", "poller"))
+	poller.Update(sc.PollTargets())
 
 	// load config in background to watch for config changes
 	hup := make(chan os.Signal, 1)
@@ -158,13 +457,13 @@ func main() {
 		for {
 			select {
 			case <-hup:
-				if err := sc.ReloadConfig(*configFile); err != nil {
+				if err := reloadConfig(); err != nil {
 					configLoggerCtx.WithError(err).Error("failed to reload config file")
 					break
 				}
 				configLoggerCtx.WithField("operation", "sc.ReloadConfig").Info("config file reload")
 			case rc := <-reloadCh:
-				if err := sc.ReloadConfig(*configFile); err != nil {
+				if err := reloadConfig(); err != nil {
 					configLoggerCtx.WithError(err).Error("failed to reload config file")
 					rc <- err
 					break
@@ -175,6 +474,21 @@ func main() {
 		}
 	}()
 
+	// log out of the cached sessions on shutdown
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-term
+		rootLoggerCtx.WithField("signal", sig.String()).Info("shutting down, logging out of redfish sessions")
+		poller.Stop()
+		sessionCache.Close()
+		if err := logPipeline.Cursors.Save(); err != nil {
+			rootLoggerCtx.WithError(err).Error("error saving log cursors")
+		}
+		closeLogSinks()
+		os.Exit(0)
+	}()
+
 	http.Handle("/redfish", metricsHandler())                // Regular metrics endpoint for local Redfish metrics.
 	http.Handle("/-/reload", reloadHandler(configLoggerCtx)) // HTTP endpoint for triggering configuration reload
 	http.Handle("/metrics", promhttp.Handler())
@@ -190,6 +504,7 @@ func main() {
             <form action="/redfish">
             <label>Target:</label> <input type="text" name="target" placeholder="X.X.X.X" value="1.2.3.4"><br>
             <label>Group:</label> <input type="text" name="group" placeholder="group (optional)" value=""><br>
+            <label>Module:</label> <input type="text" name="module" placeholder="module (optional)" value=""><br>
             <input type="submit" value="Submit">
 						</form>
 						<p><a href="/metrics">Local metrics</a></p>
@@ -199,7 +514,7 @@ func main() {
 
 	rootLoggerCtx.Infof("app started. listening on %s", *listenAddress)
 	srv := &http.Server{Addr: *listenAddress}
-	err := web.ListenAndServe(srv, *webConfig, kitlogger)
+	err = web.ListenAndServe(srv, *webConfig, kitlogger)
 	if err != nil {
 		log.Fatal(err)
 	}
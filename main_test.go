@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	alog "github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
+	"github.com/jenningsloy318/redfish_exporter/collector"
+)
+
+func TestApplyLogSinks(t *testing.T) {
+	sc = &SafeConfig{C: &Config{LogSinks: LogSinksConfig{
+		Loki: &LokiSinkConfig{URL: "http://127.0.0.1:3100/loki/api/v1/push"},
+	}}}
+	logPipeline = &collector.LogPipeline{}
+	defer closeLogSinks()
+
+	applyLogSinks()
+	loki := logSinks["loki"].sink
+	if loki == nil {
+		t.Fatal("applyLogSinks() started no loki sink")
+	}
+	applyLogSinks()
+	if logSinks["loki"].sink != loki {
+		t.Errorf("applyLogSinks() replaced the loki sink whose configuration did not change")
+	}
+
+	sc.C = &Config{LogSinks: LogSinksConfig{
+		Loki: &LokiSinkConfig{URL: "http://127.0.0.1:3100/loki/api/v1/push", TenantID: "infra"},
+	}}
+	applyLogSinks()
+	if logSinks["loki"].sink == loki {
+		t.Errorf("applyLogSinks() kept the loki sink whose configuration changed")
+	}
+
+	sc.C = &Config{}
+	applyLogSinks()
+	if len(logSinks) != 0 {
+		t.Errorf("applyLogSinks() kept %d sinks of a configuration without sinks", len(logSinks))
+	}
+}
+
+func TestHostConfigForLogsMatch(t *testing.T) {
+	rules := []HostRule{{CIDR: "10.0.0.0/8"}}
+	if err := rules[0].compile(); err != nil {
+		t.Fatalf("compile() = %s", err)
+	}
+	sc = &SafeConfig{C: &Config{
+		Hosts:     map[string]HostConfig{"default": {Username: "default"}},
+		HostRules: rules,
+		Groups:    map[string]HostConfig{"lab": {Username: "lab"}},
+	}}
+	handler := memory.New()
+	logger := alog.NewEntry(&alog.Logger{Handler: handler, Level: alog.InfoLevel})
+	matched := func() []string {
+		var rules []string
+		for _, entry := range handler.Entries {
+			rules = append(rules, entry.Fields.Get("rule").(string))
+		}
+		handler.Entries = nil
+		return rules
+	}
+
+	for i := 0; i < 2; i++ {
+		for _, target := range []string{"10.0.0.1", "192.168.0.1"} {
+			if _, err := hostConfigFor(target, "", logger); err != nil {
+				t.Fatalf("hostConfigFor(%s) = %s", target, err)
+			}
+		}
+		if _, err := hostConfigFor("10.0.0.1", "lab", logger); err != nil {
+			t.Fatalf("hostConfigFor(10.0.0.1, lab) = %s", err)
+		}
+	}
+	want := []string{"host_rules[0] " + rules[0].String(), "hosts[default]", "groups[lab]"}
+	if got := matched(); !reflect.DeepEqual(got, want) {
+		t.Errorf("logged matches = %q, want each once: %q", got, want)
+	}
+
+	// a reload changing the entry of a target logs it again
+	sc.C = &Config{Hosts: map[string]HostConfig{"default": {Username: "default"}}}
+	hostConfigFor("10.0.0.1", "", logger)
+	hostConfigFor("192.168.0.1", "", logger)
+	if got := matched(); !reflect.DeepEqual(got, []string{"hosts[default]"}) {
+		t.Errorf("logged matches after a reload = %q, want only the changed one", got)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"sync"
+	"time"
+
+	alog "github.com/apex/log"
+	"github.com/jenningsloy318/redfish_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// defaultPollInterval is used for polled targets whose host config has no poll_interval.
+const defaultPollInterval = time.Minute
+
+// Poller scrapes the polling targets in the background and keeps the latest result of each of them in memory.
+type Poller struct {
+	mu      sync.RWMutex
+	results map[PollTarget]*pollResult
+	// energy holds the energy estimates of the targets, they are only used by the poll of their target
+	energy map[PollTarget]*collector.EnergyEstimate
+	// runMu guards runs and serializes Update and Stop, which may be called by a reload and a shutdown at the same
+	// time.
+	runMu sync.Mutex
+	runs  map[PollTarget]*pollRun
+	Log   *alog.Entry
+}
+
+// pollRun is the polling of one target with the settings it was started with.
+type pollRun struct {
+	hostConfig *HostConfig
+	module     *ModuleConfig
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+// pollResult holds the metrics gathered by one poll or scrape of a target.
+type pollResult struct {
+	families []*dto.MetricFamily
+	err      error
+	time     time.Time
+}
+
+// Gather implements prometheus.Gatherer.
+func (r *pollResult) Gather() ([]*dto.MetricFamily, error) {
+	return r.families, r.err
+}
+
+// ageGauge returns a gauge set to the age of the result.
+func (r *pollResult) ageGauge() prometheus.Gauge {
+	age := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "redfish",
+		Subsystem: "exporter",
+		Name:      "cache_age_seconds",
+		Help:      "Age of the cached metrics served for a target.",
+	})
+	age.Set(time.Since(r.time).Seconds())
+	return age
+}
+
+// NewPoller returns a Poller without targets, they are set with Update.
+func NewPoller(logger *alog.Entry) *Poller {
+	return &Poller{
+		results: make(map[PollTarget]*pollResult),
+		energy:  make(map[PollTarget]*collector.EnergyEstimate),
+		runs:    make(map[PollTarget]*pollRun),
+		Log:     logger,
+	}
+}
+
+// Update polls the given targets. The targets no longer given and those whose host config or module changed are
+// stopped, the polls of the other targets carry on undisturbed. The results of targets that are still polled are
+// kept.
+func (p *Poller) Update(targets []PollTarget) {
+	p.runMu.Lock()
+	defer p.runMu.Unlock()
+
+	keep := make(map[PollTarget]bool)
+	for _, target := range targets {
+		keep[target] = true
+	}
+	var stopped []*pollRun
+	for target, run := range p.runs {
+		hostConfig, module := p.settings(target)
+		if keep[target] && reflect.DeepEqual(hostConfig, run.hostConfig) && reflect.DeepEqual(module, run.module) {
+			continue
+		}
+		run.cancel()
+		stopped = append(stopped, run)
+		delete(p.runs, target)
+	}
+	for _, run := range stopped {
+		<-run.done
+	}
+	p.mu.Lock()
+	for target := range p.results {
+		if !keep[target] {
+			delete(p.results, target)
+		}
+	}
+	for target := range p.energy {
+		if !keep[target] {
+			delete(p.energy, target)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, target := range targets {
+		if _, ok := p.runs[target]; ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		run := &pollRun{cancel: cancel, done: make(chan struct{})}
+		run.hostConfig, run.module = p.settings(target)
+		p.runs[target] = run
+		go p.run(ctx, target, run.done)
+	}
+}
+
+// settings returns the host config and module the target is polled with, nil when they cannot be resolved.
+func (p *Poller) settings(target PollTarget) (*HostConfig, *ModuleConfig) {
+	hostConfig, _ := hostConfigFor(target.Target, target.Group, p.Log.WithField("target", target.Target))
+	module, _ := sc.ModuleConfig(target.Module)
+	return hostConfig, module
+}
+
+// Stop stops polling and waits for the running polls to return.
+func (p *Poller) Stop() {
+	p.runMu.Lock()
+	defer p.runMu.Unlock()
+	for _, run := range p.runs {
+		run.cancel()
+	}
+	for target, run := range p.runs {
+		<-run.done
+		delete(p.runs, target)
+	}
+}
+
+// Result returns the latest result of a polled target, if it has been polled already.
+func (p *Poller) Result(target PollTarget) (*pollResult, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	result, ok := p.results[target]
+	return result, ok
+}
+
+// energyEstimate returns the energy estimate of the target, the estimates of the targets still polled after an
+// Update carry on.
+func (p *Poller) energyEstimate(target PollTarget) *collector.EnergyEstimate {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	estimate, ok := p.energy[target]
+	if !ok {
+		estimate = collector.NewEnergyEstimate()
+		p.energy[target] = estimate
+	}
+	return estimate
+}
+
+// run polls the target until ctx is done and closes done then, the first poll happens after a random part of the
+// jitter.
+func (p *Poller) run(ctx context.Context, target PollTarget, done chan<- struct{}) {
+	defer close(done)
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	var delay time.Duration
+	for {
+		interval, jitter := p.schedule(target)
+		if jitter > 0 {
+			delay += time.Duration(random.Int63n(int64(jitter)))
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		p.poll(ctx, target, interval)
+		delay = interval
+	}
+}
+
+// schedule returns the poll interval and jitter configured for the target.
+func (p *Poller) schedule(target PollTarget) (time.Duration, time.Duration) {
+	hostConfig, err := hostConfigFor(target.Target, target.Group, p.Log.WithField("target", target.Target))
+	if err != nil || hostConfig.PollInterval == 0 {
+		return defaultPollInterval, 0
+	}
+	return hostConfig.PollInterval, hostConfig.PollJitter
+}
+
+// poll scrapes the target once and stores the result, a poll is bounded by the timeout of the host and module or
+// else by the poll interval.
+func (p *Poller) poll(ctx context.Context, target PollTarget, interval time.Duration) {
+	targetLoggerCtx := p.Log.WithField("target", target.Target)
+	targetLoggerCtx.Info("polling target host")
+
+	hostConfig, err := hostConfigFor(target.Target, target.Group, targetLoggerCtx)
+	if err != nil {
+		targetLoggerCtx.WithError(err).Error("error getting credentials")
+		return
+	}
+	module, err := sc.ModuleConfig(target.Module)
+	if err != nil {
+		targetLoggerCtx.WithError(err).Error("error getting module")
+		return
+	}
+
+	timeout := interval
+	if hostConfig.Timeout > 0 {
+		timeout = hostConfig.Timeout
+	}
+	if module.Timeout > 0 && module.Timeout < timeout {
+		timeout = module.Timeout
+	}
+	pollCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	release, err := acquireTargetSlot(pollCtx)
+	if err != nil {
+		targetLoggerCtx.WithError(err).Warn("too many targets scraped at the same time")
+		return
+	}
+	defer release()
+
+	collector, err := newTargetCollector(pollCtx, target.Target, hostConfig, module, p.energyEstimate(target), targetLoggerCtx)
+	if err != nil {
+		targetLoggerCtx.WithError(err).Error("error creating collector")
+		return
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	families, err := registry.Gather()
+	if err != nil {
+		targetLoggerCtx.WithError(err).Warn("error gathering metrics of polled target")
+	}
+	// a poll interrupted by Stop is incomplete, the previous result is kept instead
+	if ctx.Err() != nil {
+		return
+	}
+
+	p.mu.Lock()
+	p.results[target] = &pollResult{families: families, time: time.Now()}
+	p.mu.Unlock()
+	targetLoggerCtx.Info("polling target host completed")
+}
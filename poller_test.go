@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	alog "github.com/apex/log"
+)
+
+func TestPollerUpdate(t *testing.T) {
+	previous := sc
+	defer func() { sc = previous }()
+	// without hosts the polls fail right away instead of connecting to the targets
+	sc = &SafeConfig{C: &Config{Modules: map[string]ModuleConfig{
+		"a": {Collectors: []string{"chassis"}},
+		"b": {Collectors: []string{"chassis"}},
+	}}}
+
+	poller := NewPoller(alog.WithField("test", t.Name()))
+	defer poller.Stop()
+	kept := PollTarget{Target: "kept", Module: "a"}
+	changed := PollTarget{Target: "changed", Module: "b"}
+	removed := PollTarget{Target: "removed", Module: "a"}
+	poller.Update([]PollTarget{kept, changed, removed})
+	runs := make(map[PollTarget]*pollRun)
+	for target, run := range poller.runs {
+		runs[target] = run
+	}
+
+	sc.C.Modules["b"] = ModuleConfig{Collectors: []string{"system"}}
+	added := PollTarget{Target: "added", Module: "a"}
+	poller.Update([]PollTarget{kept, changed, added})
+
+	if poller.runs[kept] != runs[kept] {
+		t.Errorf("the polling of the unchanged target was restarted")
+	}
+	if poller.runs[changed] == nil || poller.runs[changed] == runs[changed] {
+		t.Errorf("the polling of the target whose module changed was not restarted")
+	}
+	if poller.runs[added] == nil {
+		t.Errorf("the added target is not polled")
+	}
+	if _, ok := poller.runs[removed]; ok {
+		t.Errorf("the removed target is still polled")
+	}
+	select {
+	case <-runs[removed].done:
+	default:
+		t.Errorf("the polling of the removed target did not stop")
+	}
+}